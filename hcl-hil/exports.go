@@ -0,0 +1,44 @@
+// +build js
+
+package main
+
+import (
+	"github.com/gopherjs/gopherjs/js"
+	"github.com/hashicorp/hil/ast"
+	"github.com/openixia/terraform-visualizer/hcl-hil/tfviz"
+)
+
+const typeInvalid = ast.TypeInvalid
+const typeAny = ast.TypeAny
+const typeBool = ast.TypeBool
+const typeString = ast.TypeString
+const typeInt = ast.TypeInt
+const typeFloat = ast.TypeFloat
+const typeList = ast.TypeList
+const typeMap = ast.TypeMap
+const typeUnknown = ast.TypeUnknown
+
+func main() {
+	exports := js.Module.Get("exports")
+	exports.Set("parseHcl", tfviz.ParseHcl)
+	exports.Set("parseHil", tfviz.ParseHilWithPosition)
+	exports.Set("readPlan", tfviz.ReadPlan)
+	exports.Set("loadJSON", tfviz.LoadJSON)
+	exports.Set("loadDir", tfviz.LoadDir)
+	exports.Set("hclToCytoscape", tfviz.HclToCytoscape)
+	exports.Set("dirToCytoscape", tfviz.DirToCytoscape)
+	exports.Set("planToCytoscape", tfviz.PlanToCytoscape)
+	exports.Set("stateToCytoscape", tfviz.StateToCytoscape)
+	exports.Set("configToCytoscape", tfviz.ConfigToCytoscape)
+	exports.Set("ast", map[string]interface{}{
+		"TYPE_INVALID": typeInvalid,
+		"TYPE_ANY":     typeAny,
+		"TYPE_BOOL":    typeBool,
+		"TYPE_STRING":  typeString,
+		"TYPE_INT":     typeInt,
+		"TYPE_FLOAT":   typeFloat,
+		"TYPE_LIST":    typeList,
+		"TYPE_MAP":     typeMap,
+		"TYPE_UNKNOWN": typeUnknown,
+	})
+}
@@ -0,0 +1,82 @@
+// Package handler is how tfviz evaluates resource types.  Every resource type it draws has a
+// Handler registered for it, and in-house resource types are drawn by registering one from the
+// init function of a package linked into tfviz with a blank import.
+package handler
+
+import (
+	"sort"
+
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/openixia/terraform-visualizer/hcl-hil/topology"
+)
+
+// Resource is the resource instance a handler evaluates
+type Resource struct {
+	ID     string // its address, e.g. aws_instance.web[2] or module.app.aws_instance.web
+	Info   *terraform.InstanceInfo
+	Config *terraform.ResourceConfig
+}
+
+// Graph is the diagram handlers draw their resources in
+type Graph interface {
+	// Address is the id of the node of the resource ref refers to, ref being a reference such
+	// as ${aws_subnet.web.id} or the address of a resource in the module of r
+	Address(r *Resource, ref string) string
+	// AddNode draws r in parent, the id of a drawn node, or at the top when parent is empty
+	AddNode(r *Resource, parent string) error
+	// AddEdge draws the traffic from source to target on a protocol, with from and to the range
+	// of ports as in a security group rule.  The ports of edges drawn twice are merged.
+	AddEdge(source string, target string, protocol string, from int, to int) error
+	// JoinSecurityGroup makes the node of r a member of security group sg, the id of an
+	// aws_security_group, drawing the traffic the rules of sg allow between r and the members
+	// of the security groups they name
+	JoinSecurityGroup(r *Resource, sg string) error
+	// JoinSubnet draws the traffic the security group rules by cidr block allow to the node of
+	// r, for a resource placed in subnet
+	JoinSubnet(r *Resource, subnet string) error
+}
+
+// Context is the state shared by the handlers of all the resources of a configuration
+type Context struct {
+	Graph          Graph
+	Topology       *topology.Topology // where the drawn resources are placed
+	SecurityGroups *dag.Graph         // security group pathing graph
+}
+
+// Handler adds the nodes and edges of the resource types it handles, one resource instance at a
+// time.  Instances aren't evaluated in any particular order beyond the dependencies between them.
+type Handler interface {
+	Types() []string
+	Handle(ctx *Context, r *Resource) error
+}
+
+// resource type -> its handler
+var handlers = map[string]Handler{}
+
+// Register makes h handle its resource types.  Registering a type twice panics, like registering
+// a database driver twice.
+func Register(h Handler) {
+	for _, t := range h.Types() {
+		if _, ok := handlers[t]; ok {
+			panic("handler.Register called twice for " + t)
+		}
+		handlers[t] = h
+	}
+}
+
+// Lookup is the handler registered for a resource type
+func Lookup(resourceType string) (Handler, bool) {
+	h, ok := handlers[resourceType]
+	return h, ok
+}
+
+// Types are the resource types with a handler, sorted
+func Types() []string {
+	var types []string
+	for t := range handlers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,16 @@
+// +build !js
+
+package main
+
+import (
+	"os"
+
+	"github.com/openixia/terraform-visualizer/hcl-hil/tfviz"
+)
+
+// tfviz is the native command line front end, with the handlers of the tfviz package.  In-house
+// resource types are linked in by adding a blank import of their handler package here, or by a
+// main package of their own calling tfviz.Main the same way.
+func main() {
+	os.Exit(tfviz.Main(os.Args[1:]))
+}
@@ -0,0 +1,109 @@
+package tfviz
+
+import (
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// autoscalingState is what autoscaling groups launch their instances from
+type autoscalingState struct {
+	LaunchSecurityGroups map[string][]string // launch configuration or template -> security groups of its instances
+}
+
+func newAutoscalingState() autoscalingState {
+	return autoscalingState{
+		LaunchSecurityGroups: make(map[string][]string),
+	}
+}
+
+// security groups of the instances an aws_launch_configuration or aws_launch_template launches
+func launchSecurityGroups(ii *terraform.InstanceInfo, c *terraform.ResourceConfig) []string {
+	var sgs []string
+	add := func(list interface{}) {
+		ids, _ := list.([]interface{})
+		for _, sg := range ids {
+			if s, ok := sg.(string); ok {
+				sgs = append(sgs, modulePath(ii.ModulePath, strip(s)))
+			}
+		}
+	}
+	switch ii.Type {
+	case "aws_launch_configuration":
+		if p, ok := c.Get("security_groups"); ok {
+			add(p)
+		}
+	case "aws_launch_template":
+		if p, ok := c.Get("vpc_security_group_ids"); ok {
+			add(p)
+		}
+		if p, ok := c.Get("network_interfaces"); ok {
+			for _, ni := range p.([]map[string]interface{}) {
+				add(ni["security_groups"])
+			}
+		}
+	}
+	return sgs
+}
+
+// the launch configuration or template an aws_autoscaling_group launches instances from
+func launchSource(ii *terraform.InstanceInfo, c *terraform.ResourceConfig) (string, bool) {
+	if p, ok := c.Get("launch_configuration"); ok {
+		return stripAttribute(ii, p.(string), "name"), true
+	}
+	templates, _ := c.Get("launch_template")
+	if policies, ok := c.Get("mixed_instances_policy"); ok {
+		// mixed_instances_policy { launch_template { launch_template_specification { ... } } }
+		for _, policy := range policies.([]map[string]interface{}) {
+			lts, _ := policy["launch_template"].([]map[string]interface{})
+			for _, lt := range lts {
+				templates = lt["launch_template_specification"]
+			}
+		}
+	}
+	blocks, _ := templates.([]map[string]interface{})
+	for _, lt := range blocks {
+		for _, key := range []string{"id", "launch_template_id", "name", "launch_template_name"} {
+			if ref, ok := lt[key].(string); ok && isInterpolated(ref) {
+				// strip takes care of .id references
+				return stripAttribute(ii, ref, "name"), true
+			}
+		}
+	}
+	return "", false
+}
+
+// draw an aws_autoscaling_group as an autoscaling node in each of its subnets, with the
+// reachability of the security groups of its launch configuration or template, and register the
+// nodes with its target groups
+func evalAutoscalingResource(info *cytoInstanceInfo, c *terraform.ResourceConfig, g *dag.Graph, thisGraph *graph) error {
+	ii := info.II
+
+	switch ii.Type {
+	case "aws_launch_configuration", "aws_launch_template":
+		thisGraph.Autoscaling.LaunchSecurityGroups[info.ID] = launchSecurityGroups(ii, c)
+
+	case "aws_autoscaling_group":
+		var subnets []string
+		if p, ok := c.Get("vpc_zone_identifier"); ok {
+			for _, sub := range p.([]interface{}) {
+				subnets = append(subnets, modulePath(ii.ModulePath, strip(sub.(string))))
+			}
+		}
+		var sgs []string
+		if source, ok := launchSource(ii, c); ok {
+			sgs = thisGraph.Autoscaling.LaunchSecurityGroups[source]
+		}
+		clones, err := cloneBySubnet(info, c, subnets, sgs, g, thisGraph)
+		if err != nil {
+			return err
+		}
+		if p, ok := c.Get("target_group_arns"); ok {
+			for _, tg := range p.([]interface{}) {
+				for _, clone := range clones {
+					thisGraph.addLbTarget(stripAttribute(ii, tg.(string), "arn"), lbTarget{ID: clone})
+				}
+			}
+		}
+	}
+	return nil
+}
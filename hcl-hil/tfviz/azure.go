@@ -0,0 +1,329 @@
+package tfviz
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// azureNic is the subnet an azurerm_network_interface is in, through its primary ip
+// configuration
+type azureNic struct {
+	Subnet string
+	Public bool // has a public ip address
+}
+
+// nsgRule is a security rule of an azurerm_network_security_group, inline or from an
+// azurerm_network_security_rule
+type nsgRule struct {
+	Priority     int
+	Outbound     bool
+	Allow        bool
+	Ports        portSet
+	Sources      []string // address prefixes: cidr blocks, addresses or service tags like VirtualNetwork
+	Destinations []string
+}
+
+// azureState is the azure machines, their interfaces and the network security groups
+type azureState struct {
+	Nics            map[string]azureNic  // azurerm_network_interface -> its subnet and whether it has a public ip
+	Vms             map[string]string    // azure virtual machine -> its primary network interface
+	NsgRules        map[string][]nsgRule // network security group -> rules, inline or from azurerm_network_security_rule
+	NsgAssociations map[string]string    // subnet or network interface -> its network security group
+}
+
+func newAzureState() azureState {
+	return azureState{
+		Nics:            make(map[string]azureNic),
+		Vms:             make(map[string]string),
+		NsgRules:        make(map[string][]nsgRule),
+		NsgAssociations: make(map[string]string),
+	}
+}
+
+// the rules every network security group ends with
+var defaultNsgRules = []nsgRule{
+	{Priority: 65000, Allow: true, Ports: portSet{{Protocol: "all"}}, Sources: []string{"VirtualNetwork"}, Destinations: []string{"VirtualNetwork"}},
+	{Priority: 65001, Allow: true, Ports: portSet{{Protocol: "all"}}, Sources: []string{"AzureLoadBalancer"}, Destinations: []string{"*"}},
+	{Priority: 65500, Ports: portSet{{Protocol: "all"}}, Sources: []string{"*"}, Destinations: []string{"*"}},
+	{Priority: 65000, Outbound: true, Allow: true, Ports: portSet{{Protocol: "all"}}, Sources: []string{"VirtualNetwork"}, Destinations: []string{"VirtualNetwork"}},
+	{Priority: 65001, Outbound: true, Allow: true, Ports: portSet{{Protocol: "all"}}, Sources: []string{"*"}, Destinations: []string{"Internet"}},
+	{Priority: 65500, Outbound: true, Ports: portSet{{Protocol: "all"}}, Sources: []string{"*"}, Destinations: []string{"*"}},
+}
+
+// the single and list forms of an attribute of a security rule, e.g. source_address_prefix and
+// source_address_prefixes
+func ruleStrings(r map[string]interface{}, single string, list string) []string {
+	var values []string
+	if s, ok := r[single].(string); ok && s != "" {
+		values = append(values, s)
+	}
+	if l, ok := r[list].([]interface{}); ok {
+		for _, v := range l {
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+	return values
+}
+
+// a security rule from a security_rule block or an azurerm_network_security_rule.  Source
+// ports are left out, rules hardly ever restrict them.
+func newNsgRule(r map[string]interface{}) nsgRule {
+	rule := nsgRule{
+		Sources:      ruleStrings(r, "source_address_prefix", "source_address_prefixes"),
+		Destinations: ruleStrings(r, "destination_address_prefix", "destination_address_prefixes"),
+	}
+	rule.Priority, _ = intValue(r["priority"])
+	rule.Outbound = strings.EqualFold(fmt.Sprint(r["direction"]), "Outbound")
+	rule.Allow = strings.EqualFold(fmt.Sprint(r["access"]), "Allow")
+
+	protocol := fmt.Sprint(r["protocol"])
+	if protocol == "*" {
+		protocol = "all"
+	}
+	var ports []interface{}
+	for _, p := range ruleStrings(r, "destination_port_range", "destination_port_ranges") {
+		if p == "*" {
+			ports = nil
+			break
+		}
+		ports = append(ports, p)
+	}
+	rule.Ports = firewallPorts([]map[string]interface{}{{"protocol": protocol, "ports": ports}})
+	return rule
+}
+
+// add the nodes of azure virtual networks, subnets and virtual machines, and record the network
+// interfaces and network security groups.  Which machines reach each other is only decided by
+// evalNetworkSecurityGroups, once every rule and association is known.
+func evalAzureResource(info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+	ii := info.II
+
+	switch ii.Type {
+	case "azurerm_virtual_network":
+		if err := thisGraph.addNode(info, c, "", 0); err != nil {
+			return err
+		}
+
+	case "azurerm_subnet":
+		p, ok := c.Get("virtual_network_name")
+		if !ok || !isInterpolated(p.(string)) {
+			return nil // a virtual network that isn't part of the configuration
+		}
+		if err := thisGraph.addNode(info, c, stripAttribute(ii, p.(string), "name"), 0); err != nil {
+			return err
+		}
+		prefixes := stringList(ii, c, "address_prefixes")
+		if p, ok := c.Get("address_prefix"); ok {
+			prefixes = append(prefixes, p.(string))
+		}
+		if len(prefixes) > 0 {
+			thisGraph.setSubnetCidr(info.ID, strip(prefixes[0]))
+		}
+		// azurerm 1.x associated the network security group on the subnet itself
+		if p, ok := c.Get("network_security_group_id"); ok && isInterpolated(p.(string)) {
+			thisGraph.Azure.NsgAssociations[info.ID] = modulePath(ii.ModulePath, strip(p.(string)))
+		}
+
+	case "azurerm_network_security_group":
+		if p, ok := c.Get("security_rule"); ok {
+			for _, r := range p.([]map[string]interface{}) {
+				thisGraph.Azure.NsgRules[info.ID] = append(thisGraph.Azure.NsgRules[info.ID], newNsgRule(r))
+			}
+		}
+
+	case "azurerm_network_security_rule":
+		if p, ok := c.Get("network_security_group_name"); ok && isInterpolated(p.(string)) {
+			nsg := stripAttribute(ii, p.(string), "name")
+			thisGraph.Azure.NsgRules[nsg] = append(thisGraph.Azure.NsgRules[nsg], newNsgRule(c.Config))
+		}
+
+	case "azurerm_subnet_network_security_group_association", "azurerm_network_interface_security_group_association":
+		key := "subnet_id"
+		if ii.Type == "azurerm_network_interface_security_group_association" {
+			key = "network_interface_id"
+		}
+		p, ok1 := c.Get(key)
+		nsg, ok2 := c.Get("network_security_group_id")
+		if ok1 && ok2 {
+			thisGraph.Azure.NsgAssociations[modulePath(ii.ModulePath, strip(p.(string)))] = modulePath(ii.ModulePath, strip(nsg.(string)))
+		}
+
+	case "azurerm_network_interface":
+		p, ok := c.Get("ip_configuration")
+		if !ok {
+			return nil
+		}
+		configs := p.([]map[string]interface{})
+		if len(configs) == 0 {
+			return nil
+		}
+		primary := configs[0]
+		for _, ipc := range configs {
+			if ipc["primary"] == true {
+				primary = ipc
+			}
+		}
+		sub, ok := primary["subnet_id"].(string)
+		if !ok || !isInterpolated(sub) {
+			return nil
+		}
+		nic := azureNic{Subnet: modulePath(ii.ModulePath, strip(sub))}
+		if ip, ok := primary["public_ip_address_id"].(string); ok && ip != "" {
+			nic.Public = true
+		}
+		thisGraph.Topology.AddInterface(info.ID, ii.Type, nic.Subnet)
+		thisGraph.Azure.Nics[info.ID] = nic
+		if p, ok := c.Get("network_security_group_id"); ok && isInterpolated(p.(string)) {
+			thisGraph.Azure.NsgAssociations[info.ID] = modulePath(ii.ModulePath, strip(p.(string)))
+		}
+
+	case "azurerm_linux_virtual_machine", "azurerm_windows_virtual_machine":
+		// the first interface is the primary one, only it is drawn
+		nics := stringList(ii, c, "network_interface_ids")
+		if len(nics) == 0 {
+			return nil
+		}
+		nic, ok := thisGraph.Azure.Nics[nics[0]]
+		if !ok {
+			return nil
+		}
+		if err := thisGraph.addNode(info, c, nic.Subnet, 0); err != nil {
+			return err
+		}
+		thisGraph.Azure.Vms[info.ID] = nics[0]
+		thisGraph.Topology.Attach(nics[0], info.ID)
+	}
+	return nil
+}
+
+// whether an address prefix of a security rule covers the subnet with the cidr block, or the
+// internet when cidr is nil.  Service tags other than VirtualNetwork and Internet, e.g.
+// AzureLoadBalancer, cover neither.
+func prefixMatches(prefixes []string, cidr *net.IPNet, internal []*net.IPNet) bool {
+	for _, prefix := range prefixes {
+		switch prefix {
+		case "*":
+			return true
+		case "VirtualNetwork":
+			if cidr != nil {
+				return true
+			}
+			continue
+		case "Internet":
+			if cidr == nil {
+				return true
+			}
+			continue
+		}
+		if ip := net.ParseIP(prefix); ip != nil {
+			if ip.To4() != nil {
+				prefix += "/32"
+			} else {
+				prefix += "/128"
+			}
+		}
+		if _, rng, err := net.ParseCIDR(prefix); err == nil && rangeMatches(rng, cidr, internal) {
+			return true
+		}
+	}
+	return false
+}
+
+// the ports a network security group lets through from src to dst, each the cidr block of a
+// subnet or nil for the internet.  Rules are applied in priority order, the first matching rule
+// deciding, down to the default rules.  No network security group lets everything through.
+func (g *graph) nsgAllows(nsg string, outbound bool, src *net.IPNet, dst *net.IPNet, internal []*net.IPNet) portSet {
+	all := portSet{{Protocol: "all"}}
+	if nsg == "" {
+		return all
+	}
+	var rules []nsgRule
+	for _, r := range append(append([]nsgRule{}, g.Azure.NsgRules[nsg]...), defaultNsgRules...) {
+		if r.Outbound == outbound && r.Ports != nil {
+			rules = append(rules, r)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority < rules[j].Priority
+	})
+
+	var allowed portSet
+	remaining := all
+	for _, r := range rules {
+		if !prefixMatches(r.Sources, src, internal) || !prefixMatches(r.Destinations, dst, internal) {
+			continue
+		}
+		matched := remaining.intersect(r.Ports)
+		if r.Allow {
+			allowed = allowed.merge(matched)
+		}
+		remaining = remaining.subtract(matched)
+	}
+	return allowed.collapse()
+}
+
+// the ports the network security groups of the subnet and the network interface of a virtual
+// machine let through, from src to dst.  Inbound traffic goes through the group of the subnet
+// first, outbound traffic through the group of the interface, and both have to allow it.
+func (g *graph) vmAllows(vm string, outbound bool, src *net.IPNet, dst *net.IPNet, internal []*net.IPNet) portSet {
+	nic := g.Azure.Vms[vm]
+	subnet := g.Azure.Nics[nic].Subnet
+	ports := g.nsgAllows(g.Azure.NsgAssociations[subnet], outbound, src, dst, internal)
+	return ports.intersect(g.nsgAllows(g.Azure.NsgAssociations[nic], outbound, src, dst, internal))
+}
+
+// once every resource is evaluated, draw the traffic the network security groups allow between
+// the virtual machines of each azure virtual network, and between the internet and the machines
+// with a public ip address
+func evalNetworkSecurityGroups(thisGraph *graph) error {
+	var ids []string
+	for id := range thisGraph.Azure.Vms {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	internal := thisGraph.internalRanges()
+	placement := func(vm string) (*net.IPNet, string) {
+		subnet := thisGraph.Azure.Nics[thisGraph.Azure.Vms[vm]].Subnet
+		dest, _ := thisGraph.Topology.Cidr(subnet)
+		_, cidr, err := net.ParseCIDR(dest)
+		if err != nil {
+			return nil, ""
+		}
+		return cidr, thisGraph.Topology.Parent(subnet)
+	}
+
+	for _, dst := range ids {
+		to, vnet := placement(dst)
+		if to == nil {
+			continue
+		}
+		for _, src := range ids {
+			from, fromVnet := placement(src)
+			if src == dst || from == nil || fromVnet != vnet {
+				continue
+			}
+			out := thisGraph.vmAllows(src, true, from, to, internal[vnet])
+			in := thisGraph.vmAllows(dst, false, from, to, internal[vnet])
+			if ports := out.intersect(in); ports != nil {
+				thisGraph.addEdge(src, dst, ports)
+			}
+		}
+		if !thisGraph.Azure.Nics[thisGraph.Azure.Vms[dst]].Public {
+			continue
+		}
+		if ports := thisGraph.vmAllows(dst, false, nil, to, internal[vnet]); ports != nil {
+			thisGraph.addInternet()
+			thisGraph.addEdge(internetID, dst, ports)
+		}
+		if ports := thisGraph.vmAllows(dst, true, to, nil, internal[vnet]); ports != nil {
+			thisGraph.addInternet()
+			thisGraph.addEdge(dst, internetID, ports)
+		}
+	}
+	return nil
+}
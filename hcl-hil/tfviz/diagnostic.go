@@ -0,0 +1,107 @@
+package tfviz
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	multierror "github.com/hashicorp/go-multierror"
+	hclParser "github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hil/ast"
+	"github.com/hashicorp/hil/parser"
+)
+
+// stages of the directory -> diagram pipeline a diagnostic can be reported from
+const (
+	stageLoad        = "load"
+	stageModuleFetch = "module fetch"
+	stagePlan        = "plan"
+	stageGraphBuild  = "graph build"
+)
+
+// Diagnostic describes a single failure, with the file position when one is known
+type Diagnostic struct {
+	Stage string
+	Pos   *ast.Pos
+	Err   string
+}
+
+func (d *Diagnostic) String() string {
+	if d.Pos == nil {
+		return fmt.Sprintf("%s: %s", d.Stage, d.Err)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Stage, d.Err)
+}
+
+// CytoscapeResult is returned to the JS side in place of a panic.  Data holds the cytoscape
+// JSON and is only meaningful when Diagnostics is empty.  Warnings are what the diagram leaves
+// out, e.g. traffic blocked by network acls, and come with the data.
+type CytoscapeResult struct {
+	Data        string
+	Diagnostics []*Diagnostic
+	Warnings    []*Diagnostic
+}
+
+func (r *CytoscapeResult) failed() bool {
+	return len(r.Diagnostics) > 0
+}
+
+// stageError tags an error with the pipeline stage it came from
+type stageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *stageError) Error() string {
+	return e.Err.Error()
+}
+
+func errorResult(stage string, err error) *CytoscapeResult {
+	return &CytoscapeResult{Diagnostics: newDiagnostics(stage, err)}
+}
+
+// the legacy config loader flattens hcl position errors into strings like
+// "Error parsing /tf/main.tf: At 3:7: unknown token", so recover the position from the message
+var posErrorMessage = regexp.MustCompile(`(?s)^(?:Error (?:loading|parsing|reading) (.+?): )?At (?:(.+?):)?(\d+):(\d+): (.*)$`)
+
+// flatten err into diagnostics.  stage is used unless err carries its own.
+func newDiagnostics(stage string, err error) []*Diagnostic {
+	switch e := err.(type) {
+	case *stageError:
+		return newDiagnostics(e.Stage, e.Err)
+	case *hcl2Error:
+		return e.diagnostics()
+	case *multierror.Error:
+		var diags []*Diagnostic
+		for _, inner := range e.Errors {
+			diags = append(diags, newDiagnostics(stage, inner)...)
+		}
+		return diags
+	case *hclParser.PosError:
+		return []*Diagnostic{{
+			Stage: stage,
+			Pos: &ast.Pos{
+				Filename: e.Pos.Filename,
+				Line:     e.Pos.Line,
+				Column:   e.Pos.Column,
+			},
+			Err: e.Err.Error(),
+		}}
+	case *parser.ParseError:
+		pos := e.Pos
+		return []*Diagnostic{{Stage: stage, Pos: &pos, Err: e.Message}}
+	}
+
+	d := &Diagnostic{Stage: stage, Err: err.Error()}
+	if m := posErrorMessage.FindStringSubmatch(d.Err); m != nil {
+		line, _ := strconv.Atoi(m[3])
+		column, _ := strconv.Atoi(m[4])
+		filename := m[2]
+		if filename == "" {
+			filename = m[1]
+		}
+		d.Pos = &ast.Pos{Filename: filename, Line: line, Column: column}
+		d.Err = m[5]
+	}
+	return []*Diagnostic{d}
+}
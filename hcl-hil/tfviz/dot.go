@@ -0,0 +1,96 @@
+package tfviz
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// graphviz attributes of the boxes of the compound nodes, matching web/style.json
+var dotClusterStyles = map[string]string{
+	"region":                    `style="filled"; color="#000000"; fillcolor="#f0f0fc"`,
+	"aws_vpc":                   `style="dotted"; color="#6b788c"`,
+	"google_compute_network":    `style="dotted"; color="#6b788c"`,
+	"azurerm_virtual_network":   `style="dotted"; color="#6b788c"`,
+	"az":                        `style="dashed"; color="#f4ad42"`,
+	"aws_subnet":                `style="dashed"; color="#ff5959"`,
+	"google_compute_subnetwork": `style="dashed"; color="#ff5959"`,
+	"azurerm_subnet":            `style="dashed"; color="#ff5959"`,
+}
+
+// graphviz attributes of the other nodes, by node type
+var dotNodeStyles = map[string]string{
+	"cloud":           `shape="ellipse"`,
+	"aws_lb_listener": `shape="component"`,
+	"aws_route_table": `shape="cds"`,
+}
+
+// a graphviz id or attribute value
+func dotQuote(s string) string {
+	return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+func dotClusterID(id string) string {
+	return dotQuote("cluster_" + id)
+}
+
+// the diagram in the graphviz DOT language.  Compound nodes like vpcs and subnets become
+// clusters, holding an invisible point edges to the compound node are drawn to, clipped at the
+// box of the cluster.
+func dotGraph(thisGraph *graph) (string, error) {
+	d := newDiagram(thisGraph)
+	var b bytes.Buffer
+	b.WriteString("digraph terraform {\n")
+	b.WriteString("  compound=true;\n")
+	b.WriteString("  node [shape=\"box\", style=\"rounded\"];\n")
+	for _, id := range d.Children[""] {
+		writeDotNode(&b, d, id, "  ")
+	}
+	for _, e := range d.Edges {
+		var attrs []string
+		if e.Label != "" {
+			attrs = append(attrs, "label="+dotQuote(e.Label))
+		}
+		if d.isCompound(e.Source) {
+			attrs = append(attrs, "ltail="+dotClusterID(e.Source))
+		}
+		if d.isCompound(e.Target) {
+			attrs = append(attrs, "lhead="+dotClusterID(e.Target))
+		}
+		switch {
+		case e.RepliesBlocked:
+			attrs = append(attrs, `style="dashed"`, `color="#cc0000"`)
+		case len(e.Ports) == 0:
+			attrs = append(attrs, `style="dotted"`) // an edge that carries no traffic, e.g. a route
+		}
+		fmt.Fprintf(&b, "  %s -> %s", dotQuote(e.Source), dotQuote(e.Target))
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+func writeDotNode(b *bytes.Buffer, d *diagram, id string, indent string) {
+	n := d.byID[id]
+	if !d.isCompound(id) {
+		fmt.Fprintf(b, "%s%s [label=%s", indent, dotQuote(id), dotQuote(d.label(id)))
+		if style, ok := dotNodeStyles[n.NodeType]; ok {
+			b.WriteString(", " + style)
+		}
+		b.WriteString("];\n")
+		return
+	}
+	fmt.Fprintf(b, "%ssubgraph %s {\n", indent, dotClusterID(id))
+	fmt.Fprintf(b, "%s  label=%s;\n", indent, dotQuote(d.label(id)))
+	if style, ok := dotClusterStyles[n.NodeType]; ok {
+		fmt.Fprintf(b, "%s  %s;\n", indent, style)
+	}
+	fmt.Fprintf(b, "%s  %s [shape=\"point\", style=\"invis\"];\n", indent, dotQuote(id))
+	for _, child := range d.Children[id] {
+		writeDotNode(b, d, child, indent+"  ")
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
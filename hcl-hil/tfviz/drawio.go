@@ -0,0 +1,162 @@
+package tfviz
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// the mxGraph XML read by draw.io, uncompressed
+type mxFile struct {
+	XMLName xml.Name  `xml:"mxfile"`
+	Host    string    `xml:"host,attr"`
+	Diagram mxDiagram `xml:"diagram"`
+}
+
+type mxDiagram struct {
+	ID    string       `xml:"id,attr"`
+	Name  string       `xml:"name,attr"`
+	Model mxGraphModel `xml:"mxGraphModel"`
+}
+
+type mxGraphModel struct {
+	Grid  int      `xml:"grid,attr"`
+	Cells []mxCell `xml:"root>mxCell"`
+}
+
+type mxCell struct {
+	ID       string      `xml:"id,attr"`
+	Value    string      `xml:"value,attr,omitempty"`
+	Style    string      `xml:"style,attr,omitempty"`
+	Vertex   int         `xml:"vertex,attr,omitempty"`
+	Edge     int         `xml:"edge,attr,omitempty"`
+	Parent   string      `xml:"parent,attr,omitempty"`
+	Source   string      `xml:"source,attr,omitempty"`
+	Target   string      `xml:"target,attr,omitempty"`
+	Geometry *mxGeometry `xml:"mxGeometry,omitempty"`
+}
+
+type mxGeometry struct {
+	X        int    `xml:"x,attr,omitempty"`
+	Y        int    `xml:"y,attr,omitempty"`
+	Width    int    `xml:"width,attr,omitempty"`
+	Height   int    `xml:"height,attr,omitempty"`
+	Relative int    `xml:"relative,attr,omitempty"`
+	As       string `xml:"as,attr"`
+}
+
+// the layer the diagram is drawn on, below the root cell every mxGraph model starts with
+const drawioLayer = "1"
+
+const (
+	drawioIcon      = "outlineConnect=0;fontColor=#232F3E;gradientColor=none;strokeColor=none;verticalLabelPosition=bottom;verticalAlign=top;align=center;fontSize=12;aspect=fixed;pointerEvents=1;"
+	drawioGroup     = "container=1;collapsible=0;recursiveResize=0;pointerEvents=0;verticalAlign=top;align=left;fontSize=12;"
+	drawioAwsGroup  = drawioGroup + "shape=mxgraph.aws4.group;spacingLeft=30;"
+	drawioCompute   = drawioIcon + "fillColor=#D45B07;"
+	drawioNetwork   = drawioIcon + "fillColor=#8C4FFF;"
+	drawioDatabase  = drawioIcon + "fillColor=#C925D1;"
+	drawioBox       = "rounded=1;whiteSpace=wrap;verticalLabelPosition=bottom;verticalAlign=top;fillColor=#f5f5f5;strokeColor=#666666;"
+	drawioContainer = drawioGroup + "rounded=0;fillColor=none;strokeColor=#666666;"
+)
+
+// public subnets are green in the AWS shape library, private ones blue
+const drawioPublicSubnet = drawioAwsGroup + "grIcon=mxgraph.aws4.group_security_group;grStroke=0;strokeColor=#7AA116;fillColor=#F2F6E8;fontColor=#248814;"
+
+// draw.io styles by node type, from its AWS shape library where there is a shape for it
+var drawioStyles = map[string]string{
+	"region":                     drawioAwsGroup + "grIcon=mxgraph.aws4.group_region;strokeColor=#147EBA;fillColor=none;fontColor=#147EBA;dashed=1;",
+	"az":                         drawioGroup + "fillColor=none;strokeColor=#147EBA;fontColor=#147EBA;dashed=1;",
+	"aws_vpc":                    drawioAwsGroup + "grIcon=mxgraph.aws4.group_vpc;strokeColor=#248814;fillColor=none;fontColor=#AAB7B8;",
+	"aws_subnet":                 drawioAwsGroup + "grIcon=mxgraph.aws4.group_security_group;grStroke=0;strokeColor=#147EBA;fillColor=#E6F2F8;fontColor=#147EBA;",
+	"aws_instance":               drawioCompute + "shape=mxgraph.aws4.instance2;",
+	"autoscaling":                drawioCompute + "shape=mxgraph.aws4.auto_scaling2;",
+	"aws_elb":                    drawioNetwork + "shape=mxgraph.aws4.classic_load_balancer;",
+	"aws_lb":                     drawioNetwork + "shape=mxgraph.aws4.application_load_balancer;",
+	"aws_alb":                    drawioNetwork + "shape=mxgraph.aws4.application_load_balancer;",
+	"aws_internet_gateway":       drawioNetwork + "shape=mxgraph.aws4.internet_gateway;",
+	"aws_nat_gateway":            drawioNetwork + "shape=mxgraph.aws4.nat_gateway;",
+	"aws_route_table":            drawioNetwork + "shape=mxgraph.aws4.route_table;",
+	"aws_network_interface":      drawioNetwork + "shape=mxgraph.aws4.elastic_network_interface;",
+	"aws_vpc_peering_connection": drawioNetwork + "shape=mxgraph.aws4.peering;",
+	"aws_ec2_transit_gateway":    drawioNetwork + "shape=mxgraph.aws4.transit_gateway;",
+	"rds":                        drawioDatabase + "shape=mxgraph.aws4.rds_instance;",
+	"rds_rr":                     drawioDatabase + "shape=mxgraph.aws4.rds_instance;",
+	"cloud":                      "ellipse;shape=cloud;verticalLabelPosition=bottom;verticalAlign=top;fillColor=#ffffff;strokeColor=#232F3E;",
+	"google_compute_network":     drawioContainer + "strokeColor=#6b788c;dashed=1;dashPattern=1 2;",
+	"azurerm_virtual_network":    drawioContainer + "strokeColor=#6b788c;dashed=1;dashPattern=1 2;",
+	"google_compute_subnetwork":  drawioContainer + "strokeColor=#ff5959;dashed=1;",
+	"azurerm_subnet":             drawioContainer + "strokeColor=#ff5959;dashed=1;",
+}
+
+const (
+	drawioEdge    = "edgeStyle=orthogonalEdgeStyle;rounded=1;endArrow=block;fontSize=10;"
+	drawioRoute   = drawioEdge + "dashed=1;dashPattern=1 2;strokeColor=#999999;" // an edge that carries no traffic
+	drawioBlocked = drawioEdge + "dashed=1;strokeColor=#cc0000;"
+)
+
+// the diagram as a draw.io file, with compound nodes like vpcs and subnets as containers
+func drawioXML(thisGraph *graph) (string, error) {
+	d := newDiagram(thisGraph)
+	boxes := layoutDiagram(d)
+	model := mxGraphModel{Grid: 1, Cells: []mxCell{{ID: "0"}, {ID: drawioLayer, Parent: "0"}}}
+	var addCells func(parent string)
+	addCells = func(parent string) {
+		cellParent := parent
+		if parent == "" {
+			cellParent = drawioLayer
+		}
+		for _, id := range d.Children[parent] {
+			style, ok := drawioStyles[d.byID[id].NodeType]
+			if !ok {
+				style = drawioBox
+				if d.isCompound(id) {
+					style = drawioContainer
+				}
+			}
+			if d.byID[id].Public {
+				style = drawioPublicSubnet
+			}
+			b := boxes[id]
+			model.Cells = append(model.Cells, mxCell{
+				ID:       id,
+				Value:    d.label(id),
+				Style:    style,
+				Vertex:   1,
+				Parent:   cellParent,
+				Geometry: &mxGeometry{X: b.X, Y: b.Y, Width: b.W, Height: b.H, As: "geometry"},
+			})
+			addCells(id)
+		}
+	}
+	addCells("")
+	for i, e := range d.Edges {
+		if _, ok := d.byID[e.Source]; !ok {
+			continue // an edge to a node that isn't drawn, which draw.io has nothing to attach to
+		}
+		if _, ok := d.byID[e.Target]; !ok {
+			continue
+		}
+		style := drawioEdge
+		switch {
+		case e.RepliesBlocked:
+			style = drawioBlocked
+		case len(e.Ports) == 0:
+			style = drawioRoute
+		}
+		model.Cells = append(model.Cells, mxCell{
+			ID:       fmt.Sprintf("edge%d", i),
+			Value:    e.Label,
+			Style:    style,
+			Edge:     1,
+			Parent:   drawioLayer,
+			Source:   e.Source,
+			Target:   e.Target,
+			Geometry: &mxGeometry{Relative: 1, As: "geometry"},
+		})
+	}
+	file := mxFile{Host: "tfviz", Diagram: mxDiagram{ID: "terraform", Name: "terraform", Model: model}}
+	byteArray, err := xml.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return "", &stageError{Stage: stageGraphBuild, Err: err}
+	}
+	return xml.Header + string(byteArray) + "\n", nil
+}
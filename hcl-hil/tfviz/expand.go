@@ -0,0 +1,173 @@
+package tfviz
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// instanceAddress is the address of an instance of a resource with count (an int key) or
+// for_each (a string key), e.g. aws_instance.web[2] or aws_instance.web["a"].  A nil key is a
+// resource without either.
+func instanceAddress(resource string, key interface{}) string {
+	switch k := key.(type) {
+	case int:
+		return fmt.Sprintf("%s[%d]", resource, k)
+	case string:
+		return fmt.Sprintf("%s[%q]", resource, k)
+	}
+	return resource
+}
+
+// the resource an instance address belongs to, e.g. aws_instance.web[2] -> aws_instance.web
+func resourceAddress(addr string) string {
+	if strings.HasSuffix(addr, "]") {
+		if i := strings.LastIndex(addr, "["); i >= 0 {
+			return addr[:i]
+		}
+	}
+	return addr
+}
+
+// ids the terraform 0.11 graph walk gives the instances of a resource with count > 1
+var legacyInstanceID = regexp.MustCompile(`^((?:data\.)?[^.\[]+\.[^.\[]+)\.(\d+)$`)
+
+// split an InstanceInfo id into its resource and count index, e.g. aws_instance.web.2 ->
+// aws_instance.web, 2.  The key is nil for a resource without count, or with a count of 1.
+func legacyInstanceKey(id string) (string, interface{}) {
+	if m := legacyInstanceID.FindStringSubmatch(id); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return m[1], n
+	}
+	return id, nil
+}
+
+// record an instance the DiffFn is called with, so references to the instances of its
+// resource can be resolved
+func (g *graph) addInstance(ii *terraform.InstanceInfo) {
+	id, key := legacyInstanceKey(ii.Id)
+	resource := modulePath(ii.ModulePath, id)
+	keys := append(g.Instances[resource], key)
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, _ := keys[i].(int)
+		b, _ := keys[j].(int)
+		return a < b
+	})
+	g.Instances[resource] = keys
+}
+
+// references to the instances of a resource terraform 0.11 leaves in the config, since the
+// ids they point at are only known after apply
+var (
+	elementRef = regexp.MustCompile(`^\$\{element\(([\w.-]+)\.\*\.id,\s*(count\.index|\d+)\)\}$`)
+	indexRef   = regexp.MustCompile(`^\$\{([\w.-]+)\.\*\.id\[(count\.index|\d+)\]\}$`)
+	splatRef   = regexp.MustCompile(`^\$\{([\w.-]+)\.\*\.id\}$`)
+	dottedRef  = regexp.MustCompile(`^\$\{([\w.-]+)\.(\d+)\.id\}$`)
+)
+
+// resolve a reference to the instances of a resource, e.g. element(aws_subnet.a.*.id,
+// count.index) in the instance with index 3 of a resource, into references to the instances
+// themselves, e.g. "${aws_subnet.a[1].id}" when aws_subnet.a has a count of 2.  Splats resolve
+// to every instance.
+func (g *graph) instanceRefs(ii *terraform.InstanceInfo, index int, ref string) ([]interface{}, bool) {
+	var resource string
+	var pick func(n int) (int, bool) // which of the n instances, or all of them when !ok
+	argument := func(arg string) int {
+		if arg == "count.index" {
+			return index
+		}
+		n, _ := strconv.Atoi(arg)
+		return n
+	}
+
+	if m := elementRef.FindStringSubmatch(ref); m != nil {
+		resource = m[1]
+		pick = func(n int) (int, bool) { return argument(m[2]) % n, true } // element() wraps around
+	} else if m := indexRef.FindStringSubmatch(ref); m != nil {
+		resource = m[1]
+		pick = func(n int) (int, bool) { return argument(m[2]), true }
+	} else if m := dottedRef.FindStringSubmatch(ref); m != nil {
+		resource = m[1]
+		pick = func(n int) (int, bool) { return argument(m[2]), true }
+	} else if m := splatRef.FindStringSubmatch(ref); m != nil {
+		resource = m[1]
+		pick = func(n int) (int, bool) { return 0, false }
+	} else {
+		return nil, false
+	}
+
+	keys := g.Instances[modulePath(ii.ModulePath, resource)]
+	if len(keys) == 0 {
+		return nil, false
+	}
+	i, ok := pick(len(keys))
+	if !ok {
+		refs := make([]interface{}, len(keys))
+		for i, key := range keys {
+			refs[i] = "${" + instanceAddress(resource, key) + ".id}"
+		}
+		return refs, true
+	}
+	if i < 0 || i >= len(keys) {
+		return nil, false
+	}
+	return []interface{}{"${" + instanceAddress(resource, keys[i]) + ".id}"}, true
+}
+
+// resolve the references to instances of other resources in v, a value of the config of the
+// instance with the given count index
+func (g *graph) resolveInstanceRefs(ii *terraform.InstanceInfo, index int, v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if refs, ok := g.instanceRefs(ii, index, t); ok && len(refs) == 1 {
+			return refs[0]
+		}
+	case []interface{}:
+		list := make([]interface{}, 0, len(t))
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				if refs, ok := g.instanceRefs(ii, index, s); ok {
+					// splats expand in place, e.g. ["${aws_security_group.a.*.id}"]
+					list = append(list, refs...)
+					continue
+				}
+			}
+			list = append(list, g.resolveInstanceRefs(ii, index, e))
+		}
+		return list
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = g.resolveInstanceRefs(ii, index, e)
+		}
+		return m
+	case []map[string]interface{}:
+		blocks := make([]map[string]interface{}, len(t))
+		for i, e := range t {
+			blocks[i] = g.resolveInstanceRefs(ii, index, e).(map[string]interface{})
+		}
+		return blocks
+	}
+	return v
+}
+
+// expandInstance records the instance the DiffFn is called with and returns its config with the
+// references to instances of other resources resolved.  The graph walk evaluates every
+// instance of a resource before the resources referencing it, so their count is known by then.
+func (g *graph) expandInstance(ii *terraform.InstanceInfo, c *terraform.ResourceConfig) *terraform.ResourceConfig {
+	g.addInstance(ii)
+	index := 0
+	if _, key := legacyInstanceKey(ii.Id); key != nil {
+		index = key.(int)
+	}
+	// computed values are read from Raw, so resolve both
+	return &terraform.ResourceConfig{
+		ComputedKeys: c.ComputedKeys,
+		Raw:          g.resolveInstanceRefs(ii, index, c.Raw).(map[string]interface{}),
+		Config:       g.resolveInstanceRefs(ii, index, c.Config).(map[string]interface{}),
+	}
+}
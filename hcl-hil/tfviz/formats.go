@@ -0,0 +1,208 @@
+package tfviz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// the formats a network graph can be written in, by name
+var formats = map[string]func(*graph) (string, error){
+	"cytoscape": cytoscapeJSON,
+	"topology":  topologyJSON,
+	"dot":       dotGraph,
+	"mermaid":   mermaidFlowchart,
+	"drawio":    drawioXML,
+	"graphml":   graphmlXML,
+	"gexf":      gexfXML,
+	"svg":       svgImage,
+}
+
+// the formats whose data is written as is, without a newline at the end
+var binaryFormats = map[string]bool{}
+
+// the topology the diagram is drawn from, as JSON
+func topologyJSON(thisGraph *graph) (string, error) {
+	byteArray, err := json.Marshal(thisGraph.Topology)
+	if err != nil {
+		return "", &stageError{Stage: stageGraphBuild, Err: err}
+	}
+	return string(byteArray), nil
+}
+
+// write a graph built by dirToGraph, planToGraph or stateToGraph in a format, or report why it
+// couldn't be built
+func formatResult(thisGraph *graph, err error, format func(*graph) (string, error)) *CytoscapeResult {
+	if err != nil {
+		return errorResult(stageGraphBuild, err)
+	}
+	if thisGraph == nil {
+		return errorResult(stageGraphBuild, errors.New("no graph was built"))
+	}
+	data, err := format(thisGraph)
+	if err != nil {
+		return errorResult(stageGraphBuild, err)
+	}
+	return &CytoscapeResult{Data: data, Warnings: thisGraph.Warnings}
+}
+
+// diagram is the drawn nodes and edges of a graph, with the nodes placed in each node, for the
+// formats that nest nodes the way cytoscape does with parents
+type diagram struct {
+	Nodes    []cytoscapeNodeBody
+	Edges    []cytoscapeNodeBody
+	Children map[string][]string // node -> nodes placed in it, "" -> top level nodes
+	byID     map[string]cytoscapeNodeBody
+}
+
+func newDiagram(thisGraph *graph) *diagram {
+	d := &diagram{Children: map[string][]string{}, byID: map[string]cytoscapeNodeBody{}}
+	for _, e := range *thisGraph.CytoscapeData {
+		if e.Data.NodeType == "edge" {
+			d.Edges = append(d.Edges, e.Data)
+			continue
+		}
+		d.Nodes = append(d.Nodes, e.Data)
+		d.byID[e.Data.ID] = e.Data
+	}
+	for _, n := range d.Nodes {
+		parent := n.Parent
+		if _, ok := d.byID[parent]; !ok {
+			parent = "" // e.g. a subnet of a vpc that isn't part of the configuration
+		}
+		d.Children[parent] = append(d.Children[parent], n.ID)
+	}
+	return d
+}
+
+// node types drawn as boxes holding other nodes, even when empty
+var containerTypes = map[string]bool{
+	"region":                    true,
+	"az":                        true,
+	"aws_vpc":                   true,
+	"aws_subnet":                true,
+	"google_compute_network":    true,
+	"google_compute_subnetwork": true,
+	"azurerm_virtual_network":   true,
+	"azurerm_subnet":            true,
+}
+
+// a node drawn as a box holding other nodes, like a vpc or a subnet
+func (d *diagram) isCompound(id string) bool {
+	return len(d.Children[id]) > 0 || containerTypes[d.byID[id].NodeType]
+}
+
+// the text shown for a node: its name, which may carry more than its address, e.g. the sizes of
+// an autoscaling group
+func (d *diagram) label(id string) string {
+	if n := d.byID[id]; n.Name != "" {
+		return n.Name
+	}
+	return id
+}
+
+// analysisNode is a node with the attributes written for graph analysis tools
+type analysisNode struct {
+	ID     string
+	Name   string
+	Type   string
+	Module string // e.g. module.network.subnets, empty for the root module
+	Parent string
+	Cidr   string
+	Access string // aws subnets: "public" when 0.0.0.0/0 is routed to an internet gateway, else "private"
+}
+
+// analysisEdge is either a node containing another, or reachability: traffic or a route from
+// source to target
+type analysisEdge struct {
+	ID             string
+	Source         string
+	Target         string
+	Kind           string // "containment" or "reachability"
+	Direction      string // reachability: "both" when target reaches source too, else "one-way"
+	Ports          string // protocols and port ranges allowed, e.g. "tcp/443, udp/53"
+	Blocked        string // ports network acls, or the security groups behind a load balancer, block
+	RepliesBlocked bool
+	Label          string
+}
+
+const (
+	containmentEdge  = "containment"
+	reachabilityEdge = "reachability"
+)
+
+// the nodes and edges of a graph for the formats of graph analysis tools, with containment as
+// edges of their own
+func analysisGraph(thisGraph *graph) ([]analysisNode, []analysisEdge) {
+	d := newDiagram(thisGraph)
+	var nodes []analysisNode
+	var edges []analysisEdge
+	addEdge := func(e analysisEdge) {
+		e.ID = fmt.Sprintf("e%d", len(edges))
+		edges = append(edges, e)
+	}
+	var addNodes func(parent string)
+	addNodes = func(parent string) {
+		for _, id := range d.Children[parent] {
+			n := analysisNode{ID: id, Name: d.label(id), Type: d.byID[id].NodeType, Module: moduleOf(id), Parent: parent}
+			if cidr, ok := thisGraph.Routing.VpcCidrs[id]; ok {
+				n.Cidr = cidr
+			} else if cidr, ok := thisGraph.Topology.Cidr(id); ok {
+				n.Cidr = cidr
+			}
+			if n.Type == "aws_subnet" {
+				n.Access = "private"
+				if d.byID[id].Public {
+					n.Access = "public"
+				}
+			}
+			nodes = append(nodes, n)
+			if parent != "" {
+				addEdge(analysisEdge{Source: parent, Target: id, Kind: containmentEdge})
+			}
+			addNodes(id)
+		}
+	}
+	addNodes("")
+	reaches := map[string]bool{}
+	for _, e := range d.Edges {
+		reaches[e.Source+" "+e.Target] = true
+	}
+	for _, e := range d.Edges {
+		if _, ok := d.byID[e.Source]; !ok {
+			continue
+		}
+		if _, ok := d.byID[e.Target]; !ok {
+			continue
+		}
+		direction := "one-way"
+		if reaches[e.Target+" "+e.Source] {
+			direction = "both"
+		}
+		addEdge(analysisEdge{
+			Source:         e.Source,
+			Target:         e.Target,
+			Kind:           reachabilityEdge,
+			Direction:      direction,
+			Ports:          strings.Join(e.Ports, ", "),
+			Blocked:        strings.Join(e.Blocked, ", "),
+			RepliesBlocked: e.RepliesBlocked,
+			Label:          e.Label,
+		})
+	}
+	return nodes, edges
+}
+
+// the module a resource is in, from its address as modulePath writes it, e.g. module.network.subnets
+// for module.network.subnets.aws_subnet.web[0]
+func moduleOf(id string) string {
+	if i := strings.IndexAny(id, "[#"); i >= 0 {
+		id = id[:i] // the index or clone suffix, which may hold dots
+	}
+	parts := strings.Split(id, ".")
+	if parts[0] != "module" || len(parts) < 4 {
+		return ""
+	}
+	return strings.Join(parts[:len(parts)-2], ".")
+}
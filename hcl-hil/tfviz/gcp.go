@@ -0,0 +1,361 @@
+package tfviz
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// gcpInstance is where a google_compute_instance is attached, through its first network
+// interface, and what firewall rules pick it by
+type gcpInstance struct {
+	Network    string
+	Subnetwork string
+	Tags       []string
+	Accounts   []string // service account emails
+	External   bool     // has an external ip address
+}
+
+// firewallRule is a google_compute_firewall.  Sources and targets left empty match every
+// instance of the network.
+type firewallRule struct {
+	Priority       int
+	Egress         bool
+	Allow          bool
+	Ports          portSet
+	Ranges         []string // source ranges of an ingress rule, destination ranges of an egress one
+	SourceTags     []string
+	SourceAccounts []string
+	TargetTags     []string
+	TargetAccounts []string
+}
+
+// gcpState is the google compute instances and the firewall rules of their networks
+type gcpState struct {
+	Instances map[string]gcpInstance    // google_compute_instance -> its network, tags and service accounts
+	Firewalls map[string][]firewallRule // google compute network -> its firewall rules
+}
+
+func newGcpState() gcpState {
+	return gcpState{
+		Instances: make(map[string]gcpInstance),
+		Firewalls: make(map[string][]firewallRule),
+	}
+}
+
+// the ports of the allow or deny blocks of a firewall rule, e.g. { protocol = "tcp", ports =
+// ["22", "8000-8080"] }
+func firewallPorts(blocks []map[string]interface{}) portSet {
+	var ports portSet
+	for _, b := range blocks {
+		protocol := strings.ToLower(fmt.Sprint(b["protocol"]))
+		if name, ok := protocolNames[protocol]; ok {
+			protocol = name
+		}
+		if protocol == "all" {
+			return portSet{{Protocol: protocol}}
+		}
+		list, _ := b["ports"].([]interface{})
+		if len(list) == 0 {
+			from, to := fullRange(protocol)
+			ports = ports.merge(portSet{{Protocol: protocol, From: from, To: to}})
+			continue
+		}
+		for _, p := range list {
+			bounds := strings.SplitN(fmt.Sprint(p), "-", 2)
+			from, ok1 := portNumber(bounds[0])
+			to, ok2 := portNumber(bounds[len(bounds)-1])
+			if ok1 && ok2 {
+				ports = ports.merge(portSet{{Protocol: protocol, From: from, To: to}})
+			}
+		}
+	}
+	return ports
+}
+
+// the strings of a list attribute, with references to other resources stripped of their
+// attribute, e.g. service account emails
+func stringList(ii *terraform.InstanceInfo, c *terraform.ResourceConfig, key string, attributes ...string) []string {
+	p, ok := c.Get(key)
+	if !ok {
+		return nil
+	}
+	var list []string
+	for _, v := range p.([]interface{}) {
+		if s, ok := v.(string); ok {
+			if isInterpolated(s) {
+				s = stripAttribute(ii, s, attributes...)
+			}
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// add the nodes of google compute networks, subnetworks and instances, and record the
+// firewall rules.  Which instances reach each other is only decided by evalFirewalls, once every
+// rule and instance is known.
+func evalGoogleResource(info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+	ii := info.II
+
+	switch ii.Type {
+	case "google_compute_network":
+		if err := thisGraph.addNode(info, c, "", 0); err != nil {
+			return err
+		}
+
+	case "google_compute_subnetwork":
+		p, ok := c.Get("network")
+		if !ok || !isInterpolated(p.(string)) {
+			return nil // a network that isn't part of the configuration
+		}
+		if err := thisGraph.addNode(info, c, stripAttribute(ii, p.(string), "self_link", "name"), 0); err != nil {
+			return err
+		}
+		if p, ok := c.Get("ip_cidr_range"); ok {
+			thisGraph.setSubnetCidr(info.ID, strip(p.(string)))
+		}
+
+	case "google_compute_instance":
+		p, ok := c.Get("network_interface")
+		if !ok {
+			return nil
+		}
+		nics := p.([]map[string]interface{})
+		if len(nics) == 0 {
+			return nil
+		}
+		// only the first interface, nic0, is drawn
+		var inst gcpInstance
+		if sub, ok := nics[0]["subnetwork"].(string); ok && isInterpolated(sub) {
+			inst.Subnetwork = stripAttribute(ii, sub, "self_link", "name")
+			inst.Network = thisGraph.Topology.Parent(inst.Subnetwork)
+		} else if network, ok := nics[0]["network"].(string); ok && isInterpolated(network) {
+			inst.Network = stripAttribute(ii, network, "self_link", "name")
+		}
+		if inst.Network == "" {
+			return nil
+		}
+		_, inst.External = nics[0]["access_config"]
+		inst.Tags = stringList(ii, c, "tags")
+		if p, ok := c.Get("service_account"); ok {
+			for _, sa := range p.([]map[string]interface{}) {
+				if email, ok := sa["email"].(string); ok {
+					if isInterpolated(email) {
+						email = stripAttribute(ii, email, "email")
+					}
+					inst.Accounts = append(inst.Accounts, email)
+				}
+			}
+		}
+		parent := inst.Subnetwork
+		if parent == "" {
+			parent = inst.Network // an auto mode network
+		}
+		if err := thisGraph.addNode(info, c, parent, 0); err != nil {
+			return err
+		}
+		thisGraph.Gcp.Instances[info.ID] = inst
+
+	case "google_compute_firewall":
+		p, ok := c.Get("network")
+		if !ok {
+			return nil
+		}
+		if d, ok := c.Get("disabled"); ok && d == true {
+			return nil
+		}
+		r := firewallRule{Priority: 1000}
+		if p, ok := c.Get("priority"); ok {
+			if n, ok := intValue(p); ok {
+				r.Priority = n
+			}
+		}
+		if d, ok := c.Get("direction"); ok {
+			r.Egress = strings.ToUpper(d.(string)) == "EGRESS"
+		}
+		if blocks, ok := c.Get("allow"); ok {
+			r.Allow = true
+			r.Ports = firewallPorts(blocks.([]map[string]interface{}))
+		} else if blocks, ok := c.Get("deny"); ok {
+			r.Ports = firewallPorts(blocks.([]map[string]interface{}))
+		}
+		if r.Egress {
+			r.Ranges = stringList(ii, c, "destination_ranges")
+			if r.Ranges == nil {
+				r.Ranges = []string{"0.0.0.0/0"}
+			}
+		} else {
+			r.Ranges = stringList(ii, c, "source_ranges")
+			r.SourceTags = stringList(ii, c, "source_tags")
+			r.SourceAccounts = stringList(ii, c, "source_service_accounts", "email")
+			if r.Ranges == nil && r.SourceTags == nil && r.SourceAccounts == nil {
+				r.Ranges = []string{"0.0.0.0/0"}
+			}
+		}
+		r.TargetTags = stringList(ii, c, "target_tags")
+		r.TargetAccounts = stringList(ii, c, "target_service_accounts", "email")
+		network := stripAttribute(ii, p.(string), "self_link", "name")
+		thisGraph.Gcp.Firewalls[network] = append(thisGraph.Gcp.Firewalls[network], r)
+	}
+	return nil
+}
+
+func intersects(a []string, b []string) bool {
+	for _, s := range a {
+		if containsString(b, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// whether a rule applies to an instance: the targets of an ingress rule or the sources of an
+// egress one
+func (r firewallRule) targets(inst gcpInstance) bool {
+	if r.TargetTags == nil && r.TargetAccounts == nil {
+		return true
+	}
+	return intersects(r.TargetTags, inst.Tags) || intersects(r.TargetAccounts, inst.Accounts)
+}
+
+// whether traffic from (ingress) or to (egress) the peer matches the rule.  The peer is either
+// an instance in a subnetwork with the cidr block, or the internet when peer is nil.
+func (r firewallRule) matches(peer *gcpInstance, cidr *net.IPNet, internal []*net.IPNet) bool {
+	if peer != nil && (intersects(r.SourceTags, peer.Tags) || intersects(r.SourceAccounts, peer.Accounts)) {
+		return true
+	}
+	if peer != nil && cidr == nil {
+		return false // an instance of an auto mode network, whose range isn't known
+	}
+	for _, rng := range r.Ranges {
+		if _, rc, err := net.ParseCIDR(rng); err == nil && rangeMatches(rc, cidr, internal) {
+			return true
+		}
+	}
+	return false
+}
+
+// whether a range of a rule covers the subnet with the cidr block, or the internet when cidr is
+// nil, i.e. addresses outside the internal ranges of the network
+func rangeMatches(rng *net.IPNet, cidr *net.IPNet, internal []*net.IPNet) bool {
+	if cidr != nil {
+		// same rule as connectByCidr: the whole subnet must be inside the range
+		return ones(rng) <= ones(cidr) && rng.Contains(cidr.IP)
+	}
+	if ones(rng) == 0 {
+		return true
+	}
+	for _, sub := range internal {
+		// a range holding an internal range, or inside one
+		if ones(rng) <= ones(sub) && rng.Contains(sub.IP) || ones(sub) <= ones(rng) && sub.Contains(rng.IP) {
+			return false
+		}
+	}
+	return true
+}
+
+// the prefix length of a cidr block
+func ones(cidr *net.IPNet) int {
+	n, _ := cidr.Mask.Size()
+	return n
+}
+
+// the cidr blocks of the subnets of each network, i.e. what isn't the internet
+func (g *graph) internalRanges() map[string][]*net.IPNet {
+	internal := map[string][]*net.IPNet{}
+	for _, sub := range g.Topology.SubnetIDs() {
+		dest, _ := g.Topology.Cidr(sub)
+		if _, cidr, err := net.ParseCIDR(dest); err == nil {
+			network := g.Topology.Parent(sub)
+			internal[network] = append(internal[network], cidr)
+		}
+	}
+	return internal
+}
+
+// the ports the firewall rules of a network let through for inst, to (egress) or from
+// (!egress) the peer.  Rules are applied in priority order, deny first at equal priority, the
+// first matching rule deciding.  What no rule matches is allowed out and denied in.
+func (g *graph) firewallAllows(inst gcpInstance, egress bool, peer *gcpInstance, cidr *net.IPNet, internal []*net.IPNet) portSet {
+	var rules []firewallRule
+	for _, r := range g.Gcp.Firewalls[inst.Network] {
+		if r.Egress == egress && r.Ports != nil && r.targets(inst) {
+			rules = append(rules, r)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return !rules[i].Allow && rules[j].Allow
+	})
+
+	var allowed portSet
+	remaining := portSet{{Protocol: "all"}}
+	for _, r := range rules {
+		if !r.matches(peer, cidr, internal) {
+			continue
+		}
+		matched := remaining.intersect(r.Ports)
+		if r.Allow {
+			allowed = allowed.merge(matched)
+		}
+		remaining = remaining.subtract(matched)
+	}
+	if egress {
+		allowed = allowed.merge(remaining)
+	}
+	return allowed.collapse()
+}
+
+// once every resource is evaluated, draw the traffic the firewall rules allow between the
+// instances of each google compute network, and between the internet and the instances with
+// an external ip address
+func evalFirewalls(thisGraph *graph) error {
+	var ids []string
+	for id := range thisGraph.Gcp.Instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	cidrOf := func(inst gcpInstance) *net.IPNet {
+		dest, _ := thisGraph.Topology.Cidr(inst.Subnetwork)
+		_, cidr, err := net.ParseCIDR(dest)
+		if err != nil {
+			return nil
+		}
+		return cidr
+	}
+	internal := thisGraph.internalRanges()
+
+	for _, dst := range ids {
+		to := thisGraph.Gcp.Instances[dst]
+		for _, src := range ids {
+			from := thisGraph.Gcp.Instances[src]
+			if src == dst || from.Network != to.Network {
+				continue
+			}
+			in := thisGraph.firewallAllows(to, false, &from, cidrOf(from), nil)
+			out := thisGraph.firewallAllows(from, true, &to, cidrOf(to), nil)
+			if ports := in.intersect(out); ports != nil {
+				thisGraph.addEdge(src, dst, ports)
+			}
+		}
+		if !to.External {
+			continue
+		}
+		if ports := thisGraph.firewallAllows(to, false, nil, nil, internal[to.Network]); ports != nil {
+			thisGraph.addInternet()
+			thisGraph.addEdge(internetID, dst, ports)
+		}
+		if ports := thisGraph.firewallAllows(to, true, nil, nil, internal[to.Network]); ports != nil {
+			thisGraph.addInternet()
+			thisGraph.addEdge(dst, internetID, ports)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package tfviz
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestFirewallAllows(t *testing.T) {
+	g := newGraph()
+	for i, cfg := range []map[string]interface{}{
+		{"network": "${google_compute_network.vpc.name}", "target_tags": []interface{}{"web"},
+			"allow": []interface{}{map[string]interface{}{"protocol": "tcp", "ports": []interface{}{"22", "80"}}}},
+		{"network": "${google_compute_network.vpc.name}", "priority": "900", "source_ranges": []interface{}{"10.0.9.0/24"},
+			"deny": []interface{}{map[string]interface{}{"protocol": "tcp", "ports": []interface{}{"22"}}}},
+		{"network": "${google_compute_network.vpc.name}", "direction": "EGRESS", "destination_ranges": []interface{}{"10.0.0.0/16"},
+			"allow": []interface{}{map[string]interface{}{"protocol": "tcp", "ports": []interface{}{"443"}}}},
+		// deny all egress: no destination ranges is every destination
+		{"network": "${google_compute_network.vpc.name}", "direction": "EGRESS", "priority": 65534,
+			"deny": []interface{}{map[string]interface{}{"protocol": "all"}}},
+	} {
+		cfg = normalizeConfig(cfg).(map[string]interface{})
+		ii := &terraform.InstanceInfo{Id: "google_compute_firewall.r" + strconv.Itoa(i), ModulePath: []string{"root"}, Type: "google_compute_firewall"}
+		if err := evalGoogleResource(newInstanceInfo(ii, 0), &terraform.ResourceConfig{Raw: cfg, Config: cfg}, g); err != nil {
+			t.Fatal(err)
+		}
+	}
+	web := gcpInstance{Network: "google_compute_network.vpc", Tags: []string{"web"}}
+	db := gcpInstance{Network: "google_compute_network.vpc", Tags: []string{"db"}}
+	other := gcpInstance{Network: "google_compute_network.other"}
+	_, internal, _ := net.ParseCIDR("10.0.0.0/16")
+
+	tests := []struct {
+		name   string
+		inst   gcpInstance
+		egress bool
+		peer   string // cidr block of the peer's subnetwork, the internet when empty
+		want   string
+	}{
+		{"ingress from the internet", web, false, "", "tcp/22, tcp/80"},
+		{"ingress denied at a higher priority", web, false, "10.0.9.0/24", "tcp/80"},
+		{"ingress to an instance no rule targets", db, false, "10.0.1.0/24", ""},
+		{"egress to an allowed range", web, true, "10.0.1.0/24", "tcp/443"},
+		{"egress to the internet denied", web, true, "", ""},
+		{"egress without rules", other, true, "", "all"},
+		{"ingress without rules", other, false, "", ""},
+	}
+	for _, tt := range tests {
+		var peer *gcpInstance
+		var cidr *net.IPNet
+		if tt.peer != "" {
+			peer = &gcpInstance{Network: tt.inst.Network}
+			_, cidr, _ = net.ParseCIDR(tt.peer)
+		}
+		got := strings.Join(g.firewallAllows(tt.inst, tt.egress, peer, cidr, []*net.IPNet{internal}).strings(), ", ")
+		if got != tt.want {
+			t.Errorf("%s: firewallAllows = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package tfviz
+
+import (
+	"encoding/xml"
+	"strconv"
+)
+
+type gexfFile struct {
+	XMLName xml.Name  `xml:"gexf"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	Mode            string           `xml:"mode,attr"`
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	Pid       string         `xml:"pid,attr,omitempty"` // the node containing this one
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Label     string         `xml:"label,attr,omitempty"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+var gexfAttributeClasses = []gexfAttributes{
+	{Class: "node", Attributes: []gexfAttribute{
+		{"type", "type", "string"},
+		{"module", "module", "string"},
+		{"parent", "parent", "string"},
+		{"cidr", "cidr", "string"},
+		{"access", "access", "string"},
+	}},
+	{Class: "edge", Attributes: []gexfAttribute{
+		{"kind", "kind", "string"},
+		{"direction", "direction", "string"},
+		{"ports", "ports", "string"},
+		{"blocked", "blocked", "string"},
+		{"replies_blocked", "replies_blocked", "boolean"},
+	}},
+}
+
+// values for the attributes that have one
+func gexfValues(keyValues ...string) []gexfAttValue {
+	var values []gexfAttValue
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		if keyValues[i+1] != "" {
+			values = append(values, gexfAttValue{For: keyValues[i], Value: keyValues[i+1]})
+		}
+	}
+	return values
+}
+
+// the graph in GEXF, for Gephi.  Containment and reachability are both edges, told apart by their
+// kind, and nodes also carry what contains them as their pid.
+func gexfXML(thisGraph *graph) (string, error) {
+	nodes, edges := analysisGraph(thisGraph)
+	g := gexfGraph{Mode: "static", DefaultEdgeType: "directed", Attributes: gexfAttributeClasses}
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, gexfNode{
+			ID:        n.ID,
+			Label:     n.Name,
+			Pid:       n.Parent,
+			AttValues: gexfValues("type", n.Type, "module", n.Module, "parent", n.Parent, "cidr", n.Cidr, "access", n.Access),
+		})
+	}
+	for _, e := range edges {
+		var repliesBlocked string
+		if e.Kind == reachabilityEdge {
+			repliesBlocked = strconv.FormatBool(e.RepliesBlocked)
+		}
+		g.Edges = append(g.Edges, gexfEdge{
+			ID:     e.ID,
+			Source: e.Source,
+			Target: e.Target,
+			Label:  e.Label,
+			AttValues: gexfValues("kind", e.Kind, "direction", e.Direction, "ports", e.Ports, "blocked", e.Blocked,
+				"replies_blocked", repliesBlocked),
+		})
+	}
+	file := gexfFile{Xmlns: "http://www.gexf.net/1.2draft", Version: "1.2", Graph: g}
+	byteArray, err := xml.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return "", &stageError{Stage: stageGraphBuild, Err: err}
+	}
+	return xml.Header + string(byteArray) + "\n", nil
+}
@@ -0,0 +1,1214 @@
+package tfviz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl"
+	hclParser "github.com/hashicorp/hcl/hcl/parser"
+	hclToken "github.com/hashicorp/hcl/hcl/token"
+	"github.com/hashicorp/hil"
+	"github.com/hashicorp/hil/ast"
+	"github.com/hashicorp/hil/parser"
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/config/module"
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/flatmap"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/openixia/terraform-visualizer/hcl-hil/topology"
+	"github.com/terraform-providers/terraform-provider-aws/aws"
+)
+
+// wrapper struct for terraform.InstanceInfo so we can do some customized behavior
+type cytoInstanceInfo struct {
+	II *terraform.InstanceInfo
+	ID string
+}
+
+// the ID is the address of the instance, e.g. aws_instance.web[2].  Clones of a resource drawn
+// more than once, like an elb in each of its subnets, get the clone index as a suffix, e.g.
+// aws_elb.web#1.
+func newInstanceInfo(ii *terraform.InstanceInfo, clone int) *cytoInstanceInfo {
+	p := new(cytoInstanceInfo)
+	resource, key := legacyInstanceKey(ii.Id)
+	id := *ii
+	id.Id = instanceAddress(resource, key)
+	p.ID = id.HumanId()
+	if clone > 0 {
+		p.ID += "#" + strconv.Itoa(clone)
+	}
+	p.II = ii
+	return p
+}
+
+// HclError is a failure to parse hcl, with its position
+type HclError struct {
+	Pos *hclToken.Pos
+	Err string
+}
+
+// ParseHcl parses hcl source for the extension
+func ParseHcl(v string) (interface{}, *HclError) {
+	result, err := hcl.ParseString(v)
+
+	if err != nil {
+		if pErr, ok := err.(*hclParser.PosError); ok {
+			return nil, &HclError{
+				Pos: &pErr.Pos,
+				Err: pErr.Err.Error(),
+			}
+		}
+
+		return result, &HclError{
+			Pos: nil,
+			Err: err.Error(),
+		}
+	}
+
+	return result, nil
+}
+
+// HilError is a failure to parse an interpolation, with its position
+type HilError struct {
+	Pos *ast.Pos
+	Err string
+}
+
+// ParseHilWithPosition parses an interpolation found at line and column of filename
+func ParseHilWithPosition(v string, column, line int, filename string) (interface{}, *HilError) {
+	result, err := hil.ParseWithPosition(v, ast.Pos{
+		Column:   column,
+		Line:     line,
+		Filename: filename,
+	})
+
+	if err != nil {
+		if pErr, ok := err.(*parser.ParseError); ok {
+			return nil, &HilError{
+				Pos: &pErr.Pos,
+				Err: pErr.String(),
+			}
+		}
+
+		return nil, &HilError{
+			Pos: nil,
+			Err: err.Error(),
+		}
+	}
+
+	return result, nil
+}
+
+// GoError is any other failure returned to the JS side
+type GoError struct {
+	Err string
+}
+
+// ReadPlan reads a terraform 0.11 binary plan
+func ReadPlan(v []uint8) (interface{}, *GoError) {
+	reader := bytes.NewReader(v)
+
+	plan, err := terraform.ReadPlan(reader)
+	if err != nil {
+		return nil, &GoError{Err: err.Error()}
+	}
+
+	return plan, nil
+}
+
+type cytoscapeNodeBody struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name,omitempty"`
+	NodeType string                 `json:"type,omitempty"`
+	LocalID  string                 `json:"local_id,omitempty"`
+	NodeData map[string]interface{} `json:"node_data,omitempty"`
+	Parent   string                 `json:"parent,omitempty"`
+	Source   string                 `json:"source,omitempty"`
+	Target   string                 `json:"target,omitempty"`
+	Ports    []string               `json:"ports,omitempty"` // edges only: protocols and port ranges allowed, e.g. "tcp/443"
+	Label    string                 `json:"label,omitempty"`
+	Blocked  []string               `json:"blocked,omitempty"` // edges only: ports network acls, or the security groups behind a load balancer, block
+
+	RepliesBlocked bool `json:"replies_blocked,omitempty"` // edges only: network acls block the replies
+	Public         bool `json:"public,omitempty"`          // aws subnets only: 0.0.0.0/0 is routed to an internet gateway
+}
+
+type cytoscapeNode struct {
+	Data cytoscapeNodeBody `json:"data"`
+}
+
+// LoadJSON loads a configuration written in JSON
+func LoadJSON(raw string) (interface{}, *GoError) {
+	load, err := config.LoadJSON([]byte(raw))
+	if err != nil {
+		return nil, &GoError{Err: err.Error()}
+	}
+	return load, nil
+}
+
+// LoadDir loads the configuration in a directory
+func LoadDir(path string) (interface{}, *GoError) {
+	load, err := config.LoadDir(path)
+	if err != nil {
+		return nil, &GoError{Err: err.Error()}
+	}
+	return load, nil
+}
+func isInterpolated(field string) bool {
+	var validInterpolation = regexp.MustCompile(`^\$\{.*\}$`)
+	return validInterpolation.MatchString(field)
+}
+
+// take an interpolated variable e.g. - "${foo.bar.id}" and return "foo.bar"
+func strip(id string) (out string) {
+
+	if isInterpolated(id) {
+		out = id[2 : len(id)-1]
+		out = strings.TrimSuffix(out, ".id")
+	} else {
+		out = id
+	}
+
+	return out
+}
+
+// the resource a reference to one of its attributes points at, qualified with the module path,
+// e.g. "${aws_lb.front.arn}" with attribute "arn" -> aws_lb.front
+func stripAttribute(ii *terraform.InstanceInfo, ref string, attributes ...string) string {
+	name := strip(ref)
+	if isInterpolated(ref) && strings.Count(name, ".") >= 2 {
+		for _, attribute := range attributes {
+			if strings.HasSuffix(name, "."+attribute) {
+				name = strings.TrimSuffix(name, "."+attribute)
+				break
+			}
+		}
+	}
+	return modulePath(ii.ModulePath, name)
+}
+
+//EndPointGroup - represents either a Security Group or a CIDR block
+type EndPointGroup struct {
+	ID        string
+	EndPoints map[string]bool // membership to EndPointGroup.  members can be other EPG's, instances or network interfaces
+}
+
+func (epg *EndPointGroup) Hashcode() interface{} {
+	return epg.ID
+}
+func NewEndPointGroup(id string) *EndPointGroup {
+	return &EndPointGroup{
+		ID:        id,
+		EndPoints: map[string]bool{},
+	}
+}
+
+// prepend name with each modulePath entry.  E.g. - if modulePath = {"root", "base", "sub"} and name = "foo", then return "module.base.sub.foo"
+func modulePath(modulePath []string, name string) string {
+	if len(modulePath) <= 1 {
+		return name
+	}
+	if strings.HasPrefix(name, "module") {
+		return name
+	}
+
+	return fmt.Sprintf(
+		"module.%s.%s",
+		strings.Join(modulePath[1:], "."),
+		name)
+}
+
+type graph struct {
+	CytoscapeData  *[]cytoscapeNode
+	Topology       *topology.Topology       // where resources are placed, their interfaces, security groups and cidr blocks
+	Instances      map[string][]interface{} // resource -> keys of the instances the DiffFn was called with, see addInstance
+	Attachments    map[string]string        // secondary network interface -> instance it is attached to
+	Clones         map[string][]string      // resource drawn in each of its subnets, e.g. a load balancer -> its clones
+	Regions        map[string]string        // resource -> region of its provider, or of its arn
+	SubnetZones    map[string]string        // subnet -> availability zone
+	Warnings       []*Diagnostic            // what the diagram leaves out, see warn
+	SecurityGroups sgState
+	Edges          edgeState
+	Routing        routingState
+	Nacls          naclState
+	LoadBalancing  lbState
+	Autoscaling    autoscalingState
+	Rds            rdsState
+	Peering        peeringState
+	Gcp            gcpState
+	Azure          azureState
+}
+
+// report something the diagram leaves out or can't show, along with the diagram
+func (g *graph) warn(format string, args ...interface{}) {
+	g.Warnings = append(g.Warnings, &Diagnostic{Stage: stageGraphBuild, Err: fmt.Sprintf(format, args...)})
+}
+
+// record the cidr block of a subnet, unless it is only known after apply, e.g. computed from a
+// data source.  The subnet is drawn but left out of the rules by cidr block.
+func (g *graph) setSubnetCidr(subnet string, cidr string) {
+	if _, _, err := net.ParseCIDR(cidr); err != nil {
+		g.warn("%s: cidr block %s is not known, rules by cidr block leave it out", subnet, cidr)
+		return
+	}
+	g.Topology.SetCidr(subnet, cidr)
+}
+
+// sgState is what evalSG paths security group rules through
+type sgState struct {
+	Paths     *dag.Graph            // security group pathing graph, shared by all the resources
+	Rules     map[string][]dag.Edge // sg -> edges of the aws_security_group_rule resources on either end
+	EdgePorts map[string]portSet    // edgeKey -> ports allowed along an edge of the sg pathing graph
+}
+
+// edgeState is the drawn edges, by edgeKey
+type edgeState struct {
+	Index map[string]int     // edgeKey -> index of the drawn edge in CytoscapeData
+	Ports map[string]portSet // edgeKey -> ports allowed along a drawn edge
+}
+
+func (g *graph) addSgRule(sgID string, e dag.Edge) {
+	g.SecurityGroups.Rules[sgID] = append(g.SecurityGroups.Rules[sgID], e)
+}
+func (g *graph) addSgEdgePorts(source string, target string, ports portSet) {
+	key := edgeKey(source, target)
+	g.SecurityGroups.EdgePorts[key] = g.SecurityGroups.EdgePorts[key].merge(ports)
+}
+func (g *graph) sgEdgePorts(source string, target string) portSet {
+	return g.SecurityGroups.EdgePorts[edgeKey(source, target)]
+}
+
+// members of an end point of the sg pathing graph: the instances of a security group, or the
+// instances in the subnets that fall inside a cidr block
+func (g *graph) endPointMembers(id string) []string {
+	_, cidr, err := net.ParseCIDR(id)
+	if err != nil {
+		return g.Topology.GroupMembers(id)
+	}
+	var members []string
+	for _, subnet := range g.Topology.SubnetsWithin(cidr) {
+		members = append(members, g.Topology.SubnetMembers(subnet)...)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// node types of web/style.json that differ from the resource type
+var nodeTypes = map[string]string{
+	"aws_autoscaling_group":    "autoscaling",
+	"aws_db_instance":          "rds",
+	"aws_rds_cluster":          "rds",
+	"aws_rds_cluster_instance": "rds",
+}
+
+func (g *graph) addNode(info *cytoInstanceInfo, c *terraform.ResourceConfig, nParent string, index int) error {
+
+	parent := strip(nParent)
+
+	name := info.II.HumanId()
+	nodeType := info.II.Type
+	if t, ok := nodeTypes[nodeType]; ok {
+		nodeType = t
+	}
+	nodeData := make(map[string]interface{})
+	switch info.II.Type {
+	case "aws_subnet":
+		if cidr, ok := c.Get("cidr_block"); ok {
+			nodeData["CidrBlock"] = cidr
+		}
+	case "aws_autoscaling_group":
+		var sizes []string
+		for _, size := range []struct{ key, field, label string }{
+			{"min_size", "MinSize", "min"},
+			{"desired_capacity", "DesiredCapacity", "desired"},
+			{"max_size", "MaxSize", "max"},
+		} {
+			if v, ok := c.Get(size.key); ok {
+				if n, ok := portNumber(v); ok {
+					nodeData[size.field] = n
+					sizes = append(sizes, fmt.Sprintf("%s %d", size.label, n))
+				}
+			}
+		}
+		if len(sizes) > 0 {
+			name += " (" + strings.Join(sizes, ", ") + ")"
+		}
+	case "aws_db_instance", "aws_rds_cluster", "aws_rds_cluster_instance":
+		if engine, ok := c.Get("engine"); ok {
+			nodeData["Engine"] = engine
+		}
+		if _, ok := c.Get("replicate_source_db"); ok {
+			nodeType = "rds_rr"
+		}
+	}
+
+	node := cytoscapeNode{
+		Data: cytoscapeNodeBody{
+			ID:       info.ID,
+			Name:     name,
+			NodeType: nodeType,
+			NodeData: nodeData,
+			Parent:   parent,
+		},
+	}
+	*g.CytoscapeData = append(*g.CytoscapeData, node)
+	g.Topology.Place(info.ID, info.II.Type, parent)
+
+	return nil
+}
+
+// drop the elements at the given indexes of CytoscapeData
+func (g *graph) removeElements(removed map[int]bool) {
+	if len(removed) == 0 {
+		return
+	}
+	kept := (*g.CytoscapeData)[:0]
+	for i, e := range *g.CytoscapeData {
+		key := edgeKey(e.Data.Source, e.Data.Target)
+		if removed[i] {
+			delete(g.Edges.Index, key)
+			delete(g.Edges.Ports, key)
+			continue
+		}
+		if e.Data.NodeType == "edge" {
+			g.Edges.Index[key] = len(kept)
+		}
+		kept = append(kept, e)
+	}
+	*g.CytoscapeData = kept
+}
+
+// draw an edge allowing ports from source to target.  Drawing the same edge again adds the
+// ports to the existing edge.
+func (g *graph) addEdge(source string, target string, ports portSet) error {
+	key := edgeKey(source, target)
+	ports = g.Edges.Ports[key].merge(ports)
+	g.Edges.Ports[key] = ports
+	if i, ok := g.Edges.Index[key]; ok {
+		edge := &(*g.CytoscapeData)[i].Data
+		edge.Ports = ports.strings()
+		edge.Label = strings.Join(edge.Ports, ", ")
+		return nil
+	}
+	node := cytoscapeNode{
+		Data: cytoscapeNodeBody{
+			NodeType: "edge",
+			Source:   source,
+			Target:   target,
+			Ports:    ports.strings(),
+			Label:    strings.Join(ports.strings(), ", "),
+		},
+	}
+	g.Edges.Index[key] = len(*g.CytoscapeData)
+	*g.CytoscapeData = append(*g.CytoscapeData, node)
+	return nil
+}
+
+// draw an edge that carries no traffic itself, e.g. a route table sending 0.0.0.0/0 to a
+// gateway, or an instance to an interface attached to it
+func (g *graph) addLabelledEdge(source string, target string, label string) {
+	key := edgeKey(source, target)
+	if i, ok := g.Edges.Index[key]; ok {
+		edge := &(*g.CytoscapeData)[i].Data
+		if label != "" {
+			edge.Label += ", " + label
+		}
+		return
+	}
+	g.Edges.Index[key] = len(*g.CytoscapeData)
+	*g.CytoscapeData = append(*g.CytoscapeData, cytoscapeNode{
+		Data: cytoscapeNodeBody{
+			NodeType: "edge",
+			Source:   source,
+			Target:   target,
+			Label:    label,
+		},
+	})
+}
+
+func newGraph() *graph {
+	return &graph{
+		CytoscapeData: &[]cytoscapeNode{},
+		Topology:      topology.New(),
+		Instances:     make(map[string][]interface{}),
+		Attachments:   make(map[string]string),
+		Clones:        make(map[string][]string),
+		Regions:       make(map[string]string),
+		SubnetZones:   make(map[string]string),
+		SecurityGroups: sgState{
+			Paths:     &dag.Graph{},
+			Rules:     make(map[string][]dag.Edge),
+			EdgePorts: make(map[string]portSet),
+		},
+		Edges: edgeState{
+			Index: make(map[string]int),
+			Ports: make(map[string]portSet),
+		},
+		Routing:       newRoutingState(),
+		Nacls:         newNaclState(),
+		LoadBalancing: newLbState(),
+		Autoscaling:   newAutoscalingState(),
+		Rds:           newRdsState(),
+		Peering:       newPeeringState(),
+		Gcp:           newGcpState(),
+		Azure:         newAzureState(),
+	}
+}
+func mockProvider(prefix string) *terraform.MockResourceProvider {
+	p := new(terraform.MockResourceProvider)
+
+	return p
+}
+func testProvider(prefix string) *terraform.MockResourceProvider {
+	p := new(terraform.MockResourceProvider)
+	p.RefreshFn = func(info *terraform.InstanceInfo, s *terraform.InstanceState) (*terraform.InstanceState, error) {
+		return s, nil
+	}
+	p.ResourcesReturn = []terraform.ResourceType{
+		terraform.ResourceType{
+			Name: fmt.Sprintf("%s_instance", prefix),
+		},
+		terraform.ResourceType{
+			Name: fmt.Sprintf("%s_vpc", prefix),
+		},
+		terraform.ResourceType{
+			Name: fmt.Sprintf("%s_resource", prefix),
+		},
+	}
+
+	return p
+}
+func mockContext(opts *terraform.ContextOpts) (*terraform.Context, error) {
+
+	// Enable the shadow graph
+	opts.Shadow = true
+
+	ctx, err := terraform.NewContext(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+func interpolateRawConfig(inter *terraform.Interpolater, scope *terraform.InterpolationScope, rc *config.RawConfig) error {
+	vs, err := inter.Values(scope, rc.Variables)
+
+	if err != nil {
+		return err
+	}
+
+	// Do the interpolation
+	if err := rc.Interpolate(vs); err != nil {
+		return err
+	}
+	// put resource computed values back to pre-interpolation
+	cfg := rc.Config()
+	for key, val := range cfg {
+		switch typedReplaceVal := val.(type) {
+		case string:
+			if typedReplaceVal == config.UnknownVariableValue {
+				cfg[key] = rc.Raw[key]
+			}
+		case []interface{}:
+			for i, v := range typedReplaceVal {
+				if strVal, ok := v.(string); ok {
+					if strVal == config.UnknownVariableValue {
+						cfg[key].([]interface{})[i] = rc.Raw[key].([]interface{})[i]
+					}
+				}
+			}
+		case map[string]interface{}:
+			for k, v := range typedReplaceVal {
+				if v == config.UnknownVariableValue {
+					cfg[key].(map[string]interface{})[k] = rc.Raw[key].(map[string]interface{})[k]
+				}
+			}
+		case []map[string]interface{}:
+			for i, a := range typedReplaceVal {
+				for k, v := range a {
+					if v == config.UnknownVariableValue {
+						cfg[key].([]map[string]interface{})[i][k] = rc.Raw[key].([]map[string]interface{})[i][k]
+					}
+				}
+			}
+		default:
+			return errors.New("unexpected variable type for key=" + key)
+		}
+		if val == config.UnknownVariableValue {
+			cfg[key] = rc.Raw[key]
+		}
+	}
+	return nil
+}
+
+// generate ResourceAttrDiffs for nested data structures in tests
+func testFlatAttrDiffs(k string, i interface{}) map[string]*terraform.ResourceAttrDiff {
+	diffs := make(map[string]*terraform.ResourceAttrDiff)
+	// check for strings and empty containers first
+	switch t := i.(type) {
+	case string:
+		diffs[k] = &terraform.ResourceAttrDiff{New: t}
+		return diffs
+	case map[string]interface{}:
+		if len(t) == 0 {
+			diffs[k] = &terraform.ResourceAttrDiff{New: ""}
+			return diffs
+		}
+	case []interface{}:
+		if len(t) == 0 {
+			diffs[k] = &terraform.ResourceAttrDiff{New: ""}
+			return diffs
+		}
+	}
+
+	flat := flatmap.Flatten(map[string]interface{}{k: i})
+
+	for k, v := range flat {
+		attrDiff := &terraform.ResourceAttrDiff{
+			Old: "",
+			New: v,
+		}
+		diffs[k] = attrDiff
+	}
+
+	return diffs
+}
+
+func evalSG(info *cytoInstanceInfo, c *terraform.ResourceConfig, g *dag.Graph, bIngress bool, tmpG *dag.Graph, thisGraph *graph) error {
+	direction := "ingress"
+	if !bIngress {
+		direction = "egress"
+	}
+	if rules, ok := c.Get(direction); ok {
+
+		for _, r := range rules.([]map[string]interface{}) {
+			ports := rulePorts(r)
+			cidrList, _ := r["cidr_blocks"].([]interface{})
+			sgList, _ := r["security_groups"].([]interface{})
+			self, _ := r["self"].(bool)
+			if len(cidrList) == 0 && len(sgList) == 0 && !self {
+				// e.g. only ipv6 cidr blocks or prefix lists, which aren't drawn
+				thisGraph.warn("%s: %s rule left out, it has no ipv4 cidr block, security group or self", info.ID, direction)
+				continue
+			}
+
+			for _, cidr := range cidrList {
+				x := strip(cidr.(string))
+				_, CIDR, err := net.ParseCIDR(x)
+				if err != nil {
+					thisGraph.warn("%s: %s rule left out, cidr block %s is not known", info.ID, direction, x)
+					continue
+				}
+				g.Add(CIDR.String())
+
+				if bIngress {
+					tmpG.Connect(dag.BasicEdge(CIDR.String(), info.ID))
+					thisGraph.addSgEdgePorts(CIDR.String(), info.ID, ports)
+				} else {
+					tmpG.Connect(dag.BasicEdge(info.ID, CIDR.String()))
+					thisGraph.addSgEdgePorts(info.ID, CIDR.String(), ports)
+				}
+
+				// handle special ingress rule allowing all traffic "0.0.0.0/0", including security groups, even itself
+				if CIDR.String() == "0.0.0.0/0" {
+					// for all the security groups and cidrs processed so far, add an edge to this security group
+					for _, v := range g.Vertices() {
+						e := dag.BasicEdge(v.(string), info.ID)
+						if !bIngress {
+							e = dag.BasicEdge(info.ID, v.(string))
+						}
+
+						if g.HasVertex(v) {
+							if g.HasEdge(e) {
+								tmpG.Connect(e)
+							}
+						}
+					}
+				}
+			}
+			for _, sg := range sgList {
+				SG := strip(sg.(string))
+				if bIngress {
+					tmpG.Connect(dag.BasicEdge(SG, info.ID))
+					thisGraph.addSgEdgePorts(SG, info.ID, ports)
+				} else {
+					tmpG.Connect(dag.BasicEdge(info.ID, SG))
+					thisGraph.addSgEdgePorts(info.ID, SG, ports)
+				}
+			}
+			if self {
+				// the members of the group reach each other, like evalSGRule does
+				tmpG.Connect(dag.BasicEdge(info.ID, info.ID))
+				thisGraph.addSgEdgePorts(info.ID, info.ID, ports)
+			}
+		}
+	}
+
+	return nil
+}
+
+// evaluate a standalone aws_security_group_rule.  The rule is merged into the sg pathing graph
+// like an inline rule, but since it may be evaluated before or after its security groups and
+// their members, edges are drawn for the members seen so far and the rule is remembered so
+// evaluating the security group later doesn't prune it.
+func evalSGRule(info *cytoInstanceInfo, c *terraform.ResourceConfig, g *dag.Graph, thisGraph *graph) error {
+	ii := info.II
+	p, ok := c.Get("security_group_id")
+	if !ok {
+		return nil
+	}
+	sg := modulePath(ii.ModulePath, strip(p.(string)))
+	bIngress := true
+	if t, ok := c.Get("type"); ok && t.(string) == "egress" {
+		bIngress = false
+	}
+
+	var peers []string
+	if cidrList, ok := c.Get("cidr_blocks"); ok {
+		for _, cidr := range cidrList.([]interface{}) {
+			_, CIDR, err := net.ParseCIDR(strip(cidr.(string)))
+			if err != nil {
+				thisGraph.warn("%s: cidr block %s is not known, the rule leaves it out", info.ID, strip(cidr.(string)))
+				continue
+			}
+			peers = append(peers, CIDR.String())
+		}
+	}
+	if src, ok := c.Get("source_security_group_id"); ok {
+		peers = append(peers, modulePath(ii.ModulePath, strip(src.(string))))
+	}
+	if self, ok := c.Get("self"); ok {
+		if b, _ := self.(bool); b {
+			peers = append(peers, sg)
+		}
+	}
+
+	ports := rulePorts(c.Config)
+
+	g.Add(sg)
+	for _, peer := range peers {
+		g.Add(peer)
+		e := dag.BasicEdge(peer, sg)
+		if !bIngress {
+			e = dag.BasicEdge(sg, peer)
+		}
+		g.Connect(e)
+		thisGraph.addSgEdgePorts(e.Source().(string), e.Target().(string), ports)
+		thisGraph.addSgRule(sg, e)
+		if _, _, err := net.ParseCIDR(peer); err != nil && peer != sg {
+			thisGraph.addSgRule(peer, e)
+		}
+
+		// members evaluated before the rule were connected without it
+		for _, v := range thisGraph.endPointMembers(e.Source().(string)) {
+			for _, w := range thisGraph.endPointMembers(e.Target().(string)) {
+				thisGraph.addEdge(v, w, ports)
+			}
+		}
+	}
+	return nil
+}
+
+func connectByCidr(info *cytoInstanceInfo, subnet string, g *dag.Graph, thisGraph *graph) error {
+	//Look for any cidr block sg rules that apply this the current instance
+	currentCidr, ok := thisGraph.Topology.Cidr(subnet)
+	if !ok {
+		return nil // a subnet whose cidr block isn't known
+	}
+	ip, cCidr, err := net.ParseCIDR(currentCidr)
+	if err != nil {
+		return err
+	}
+	cidrSize1, _ := cCidr.Mask.Size()
+	for _, v := range g.Vertices() {
+		if _, cidr, err := net.ParseCIDR(v.(string)); err == nil {
+			//found a CIDR
+			// special case: if this instance belongs to a subnet whos CIDR is *larger* than the SG rule's cidr, then *reject* connection
+			//               e.g. - if subnet CIDR = 10.0.0.0/23, and the SG rule allows ingress from 10.0.0.0/24 then don't draw the edge
+			//                      since there's a 50% chance that this instance would acquire an IP outside the range of 10.0.0.0/24, like
+			//						10.1.0.10
+			cidrSize2, _ := cidr.Mask.Size()
+			if cidrSize2 <= cidrSize1 { // the larger the mask size, the smaller the CIDR
+				if cidr.Contains(ip) {
+					// instance is a member of this CIDR
+					for _, e := range g.UpEdges(cidr.String()).List() {
+						//we assume the other end must be a security group
+						ports := thisGraph.sgEdgePorts(e.(string), cidr.String())
+						for _, v := range thisGraph.Topology.GroupMembers(e.(string)) {
+							//draw edge
+							thisGraph.addEdge(v, info.ID, ports)
+						}
+
+					}
+					for _, e := range g.DownEdges(cidr.String()).List() {
+						ports := thisGraph.sgEdgePorts(cidr.String(), e.(string))
+						for _, v := range thisGraph.Topology.GroupMembers(e.(string)) {
+							//draw edge
+							thisGraph.addEdge(info.ID, v, ports)
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+func connectBySG(info *cytoInstanceInfo, sg string, g *dag.Graph, thisGraph *graph) error {
+	for _, e := range g.UpEdges(sg).List() {
+		ports := thisGraph.sgEdgePorts(e.(string), sg)
+		for _, v := range thisGraph.Topology.GroupMembers(e.(string)) {
+			//draw edge
+			thisGraph.addEdge(v, info.ID, ports)
+		}
+	}
+	for _, e := range g.DownEdges(sg).List() {
+		ports := thisGraph.sgEdgePorts(sg, e.(string))
+		for _, v := range thisGraph.Topology.GroupMembers(e.(string)) {
+			//draw edge
+			thisGraph.addEdge(info.ID, v, ports)
+		}
+	}
+	thisGraph.Topology.AddGroupMember(sg, info.ID)
+	return nil
+}
+
+// cloneBySubnet draws a resource spanning several subnets, like a load balancer, in each of
+// them, since cytoscape nodes only have one parent, with the reachability of its security groups
+// (if any) applied to every clone.  The IDs of the clones are returned and kept in Clones.
+func cloneBySubnet(info *cytoInstanceInfo, c *terraform.ResourceConfig, subnets []string, sgs []string, g *dag.Graph, thisGraph *graph) ([]string, error) {
+	ii := info.II
+	var clones []string
+	for i, sub := range subnets {
+		clonedInfo := newInstanceInfo(ii, i)
+		if err := thisGraph.addNode(clonedInfo, c, sub, i); err != nil {
+			return clones, err
+		}
+		clones = append(clones, clonedInfo.ID)
+		thisGraph.Clones[info.ID] = clones
+
+		// process security group to security group connections
+		for _, sg := range sgs {
+			if err := connectBySG(clonedInfo, sg, g, thisGraph); err != nil {
+				return clones, err
+			}
+		}
+		//Look for any cidr block sg rules that apply this the current instance
+		if err := connectByCidr(clonedInfo, sub, g, thisGraph); err != nil {
+			return clones, err
+		}
+		thisGraph.Topology.AddMember(sub, clonedInfo.ID)
+	}
+	return clones, nil
+}
+
+// add the nodes and reachability edges of the core aws resources: vpcs, subnets, instances,
+// network interfaces, security groups and classic load balancers
+func evalAwsResource(info *cytoInstanceInfo, c *terraform.ResourceConfig, g *dag.Graph, thisGraph *graph) error {
+	ii := info.II
+
+	switch info.II.Type {
+	case "aws_vpc":
+		if err := thisGraph.addNode(info, c, "", 0); err != nil {
+			return err
+		}
+		if p, ok := c.Get("cidr_block"); ok {
+			thisGraph.Routing.VpcCidrs[info.ID] = strip(p.(string))
+		}
+		thisGraph.addArnRegion(info, c)
+	case "aws_subnet":
+		if p, ok := c.Get("vpc_id"); ok {
+			// add parent
+			vpc := strip(p.(string))
+			if err := thisGraph.addNode(info, c, modulePath(ii.ModulePath, vpc), 0); err != nil {
+				return err
+			}
+		}
+		if p, ok := c.Get("cidr_block"); ok {
+			thisGraph.setSubnetCidr(info.ID, strip(p.(string)))
+		}
+		thisGraph.addSubnetZone(info, c)
+
+	case "aws_instance":
+
+		var subnet string // subnet of the primary interface, the other interfaces are attached below
+		var sgs []string
+		secondary := map[string]int{} // network interface -> device index
+		if p, ok := c.Get("subnet_id"); ok {
+			subnet = modulePath(ii.ModulePath, strip(p.(string)))
+			if err := thisGraph.addNode(info, c, subnet, 0); err != nil {
+				return err
+			}
+			if _sgs, ok := c.Get("vpc_security_group_ids"); ok {
+				for _, sg := range _sgs.([]interface{}) {
+					sgs = append(sgs, modulePath(ii.ModulePath, strip(sg.(string))))
+				}
+			}
+		} else if p, ok := c.Get("network_interface"); ok {
+			for _, ni := range p.([]map[string]interface{}) {
+				if did, ok := portNumber(ni["device_index"]); ok {
+					if nid, ok := ni["network_interface_id"]; ok {
+						netID := modulePath(ii.ModulePath, strip(nid.(string)))
+						if did != 0 {
+							secondary[netID] = did
+							continue
+						}
+						if err := thisGraph.addNode(info, c, thisGraph.Topology.Parent(netID), 0); err != nil {
+							return err
+						}
+						thisGraph.Topology.Attach(netID, info.ID)
+						// draw network connections
+						sgs = thisGraph.Topology.InterfaceGroups(netID)
+						subnet = thisGraph.Topology.Parent(netID)
+					}
+				}
+			}
+		}
+		for _, sg := range sgs {
+			if err := connectBySG(info, sg, g, thisGraph); err != nil {
+				return err
+			}
+		}
+
+		//Look for any cidr block sg rules that apply this the current instance
+		if err := connectByCidr(info, subnet, g, thisGraph); err != nil {
+			return err
+		}
+		thisGraph.Topology.AddMember(subnet, info.ID)
+
+		var attached []string
+		for netID := range secondary {
+			attached = append(attached, netID)
+		}
+		sort.Strings(attached)
+		for _, netID := range attached {
+			if err := attachInterface(info.ID, netID, secondary[netID], g, thisGraph); err != nil {
+				return err
+			}
+		}
+
+	case "aws_network_interface":
+		if p, ok := c.Get("subnet_id"); ok {
+			subnet_id := modulePath(ii.ModulePath, strip(p.(string)))
+			thisGraph.Topology.AddInterface(info.ID, ii.Type, subnet_id)
+		}
+		if sgs, ok := c.Get("security_groups"); ok {
+			for _, _sg := range sgs.([]interface{}) {
+				sg := modulePath(ii.ModulePath, strip(_sg.(string)))
+				thisGraph.Topology.AddInterfaceGroup(info.ID, sg)
+			}
+		}
+		if p, ok := c.Get("attachment"); ok {
+			for _, a := range p.([]map[string]interface{}) {
+				if err := evalAttachment(ii, info.ID, a, "instance", g, thisGraph); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "aws_network_interface_attachment":
+		if p, ok := c.Get("network_interface_id"); ok {
+			netID := modulePath(ii.ModulePath, strip(p.(string)))
+			if err := evalAttachment(ii, netID, c.Config, "instance_id", g, thisGraph); err != nil {
+				return err
+			}
+		}
+
+	case "aws_security_group":
+
+		g.Add(info.ID)
+
+		//check for any edges pointing to 0.0.0.0/0 then connect them to this security group (SG)
+		for _, e := range g.UpEdges("0.0.0.0/0").List() {
+			g.Connect(dag.BasicEdge(e.(string), info.ID))
+			thisGraph.addSgEdgePorts(e.(string), info.ID, thisGraph.sgEdgePorts(e.(string), "0.0.0.0/0"))
+		}
+		for _, e := range g.DownEdges("0.0.0.0/0").List() {
+			g.Connect(dag.BasicEdge(info.ID, e.(string)))
+			thisGraph.addSgEdgePorts(info.ID, e.(string), thisGraph.sgEdgePorts("0.0.0.0/0", e.(string)))
+		}
+		var tmpG dag.Graph
+		if err := evalSG(info, c, g, true, &tmpG, thisGraph); err != nil {
+			return err
+		}
+		if err := evalSG(info, c, g, false, &tmpG, thisGraph); err != nil {
+			return err
+		}
+		// standalone rules already evaluated are part of this group too
+		for _, e := range thisGraph.SecurityGroups.Rules[info.ID] {
+			tmpG.Connect(e)
+		}
+		// at this point (A) g.DownEdges(info.ID) should match with (B) tmpG.DownEdges(info.ID)
+		// any differences in A should be pruned such that A is subset of B
+
+		A := g.DownEdges(info.ID)
+		B := tmpG.DownEdges(info.ID)
+		PruneSet := A.Difference(B)
+		for _, p := range PruneSet.List() {
+			g.RemoveEdge(dag.BasicEdge(info.ID, p.(string)))
+			delete(thisGraph.SecurityGroups.EdgePorts, edgeKey(info.ID, p.(string)))
+		}
+		A = g.UpEdges(info.ID)
+		B = tmpG.UpEdges(info.ID)
+		PruneSet = A.Difference(B)
+		for _, p := range PruneSet.List() {
+			g.RemoveEdge(dag.BasicEdge(p.(string), info.ID))
+			delete(thisGraph.SecurityGroups.EdgePorts, edgeKey(p.(string), info.ID))
+		}
+		// add the new edges to the main graph
+		for _, e := range tmpG.Edges() {
+			g.Connect(e)
+		}
+
+	case "aws_security_group_rule":
+		if err := evalSGRule(info, c, g, thisGraph); err != nil {
+			return err
+		}
+
+	case "aws_elb":
+		// elb can belong to multiple subnets, so that means it can have multiple "parents".  cytoscape doesn't support multiple parents,
+		// so we will need clone the elb into multiple versions of itself, one for each subnet it belongs to.
+		if p, ok := c.Get("subnets"); ok {
+			var subnets, sgs []string
+			for _, _sub := range p.([]interface{}) {
+				subnets = append(subnets, modulePath(ii.ModulePath, strip(_sub.(string))))
+			}
+			if _sgs, ok := c.Get("security_groups"); ok {
+				for _, _sg := range _sgs.([]interface{}) {
+					sgs = append(sgs, modulePath(ii.ModulePath, strip(_sg.(string))))
+				}
+			}
+			if _, err := cloneBySubnet(info, c, subnets, sgs, g, thisGraph); err != nil {
+				return err
+			}
+		}
+
+	}
+	return nil
+}
+
+// passes that need every resource evaluated first, since the terraform graph walk can evaluate
+// e.g. a route before the gateway it points to
+func finalizeGraph(g *dag.Graph, thisGraph *graph) error {
+	if err := evalRouting(g, thisGraph); err != nil {
+		return err
+	}
+	if err := evalVpcPeering(thisGraph); err != nil {
+		return err
+	}
+	if err := evalFirewalls(thisGraph); err != nil {
+		return err
+	}
+	if err := evalNetworkSecurityGroups(thisGraph); err != nil {
+		return err
+	}
+	if err := evalLoadBalancers(thisGraph); err != nil {
+		return err
+	}
+	if err := evalNetworkACLs(thisGraph); err != nil {
+		return err
+	}
+	return groupByZone(thisGraph)
+}
+func interpolateConfig(m *module.Tree, thisGraph *graph) error {
+
+	p := testProvider("aws")
+	g := thisGraph.SecurityGroups.Paths
+	var buildErr error
+	legacyRegions(m, nil, thisGraph)
+
+	p.DiffFn = func(
+		ii *terraform.InstanceInfo,
+		s *terraform.InstanceState,
+		c *terraform.ResourceConfig) (*terraform.InstanceDiff, error) {
+
+		info := newInstanceInfo(ii, 0)
+		if err := evalResource(info, thisGraph.expandInstance(ii, c), g, thisGraph); err != nil {
+			buildErr = fmt.Errorf("%s: %s", info.ID, err)
+			return nil, buildErr
+		}
+
+		// Add computed fields from the actual aws provider
+
+		if strings.HasPrefix(info.II.Type, "aws_") {
+			p := aws.Provider()
+			diff, err := p.Diff(ii, s, c)
+			if err != nil {
+				return nil, err
+			}
+			return diff, nil
+		}
+
+		return nil, nil
+	}
+
+	// every provider with registered handlers goes through the DiffFn
+	factories := map[string]terraform.ResourceProviderFactory{
+		"null": terraform.ResourceProviderFactoryFixed(p),
+	}
+	for _, provider := range handlerProviders() {
+		factories[provider] = terraform.ResourceProviderFactoryFixed(p)
+	}
+	input := new(terraform.MockUIInput)
+	ctx, err := mockContext(&terraform.ContextOpts{
+		Module:           m,
+		ProviderResolver: terraform.ResourceProviderResolverFixed(factories),
+		Parallelism:      1,
+		UIInput:          input,
+	})
+	if err != nil {
+		return err
+	}
+	input.InputFn = func(opts *terraform.InputOpts) (string, error) {
+		return "", fmt.Errorf("Try setting a default value")
+	}
+
+	if err := ctx.Input(terraform.InputModeVar | terraform.InputModeVarUnset); err != nil {
+		return err
+	}
+	//	logging.SetOutput() // suppress verbose logging that shows up in Developer Tool console screen
+
+	if _, err := ctx.Plan(); err != nil {
+		// the plan walk only passes our error back as text, so report the original
+		if buildErr != nil {
+			return &stageError{Stage: stageGraphBuild, Err: buildErr}
+		}
+		return &stageError{Stage: stagePlan, Err: err}
+	}
+	if err := finalizeGraph(g, thisGraph); err != nil {
+		return &stageError{Stage: stageGraphBuild, Err: err}
+	}
+
+	return nil
+}
+// ConfigToCytoscape is the cytoscape JSON of a loaded configuration
+func ConfigToCytoscape(configuration *config.Config) (string, error) {
+	m := module.NewTree("config", configuration)
+	return moduleToCytoscape(m)
+}
+func moduleToCytoscape(mod *module.Tree) (string, error) {
+	thisGraph, err := moduleToGraph(mod)
+	if err != nil {
+		return "", err
+	}
+	return cytoscapeJSON(thisGraph)
+}
+
+// build the network graph of a terraform 0.11 module tree
+func moduleToGraph(mod *module.Tree) (*graph, error) {
+	thisGraph := newGraph()
+
+	if err := interpolateConfig(mod, thisGraph); err != nil {
+		return nil, err
+	}
+
+	return thisGraph, nil
+}
+
+func tempDir(d string) (string, error) {
+
+	dir, err := ioutil.TempDir(d, "tf")
+	if err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// load the module tree rooted at dir, fetching any child modules into a temporary storage directory
+func loadModule(dir string) (*module.Tree, error) {
+	mod, err := module.NewTreeModule("", dir)
+	if err != nil {
+		return nil, &stageError{Stage: stageLoad, Err: err}
+	}
+
+	tmpDir, err := tempDir(dir)
+	if err != nil {
+		return nil, &stageError{Stage: stageModuleFetch, Err: err}
+	}
+	s := &module.Storage{
+		StorageDir: tmpDir,
+		Mode:       module.GetModeGet,
+	}
+	if err := mod.Load(s); err != nil {
+		return nil, &stageError{Stage: stageModuleFetch, Err: err}
+	}
+	return mod, nil
+}
+// DirToCytoscape is the cytoscape JSON of the configuration in dir
+func DirToCytoscape(dir string) *CytoscapeResult {
+	thisGraph, err := dirToGraph(dir)
+	return formatResult(thisGraph, err, cytoscapeJSON)
+}
+
+// build the network graph of the configuration in dir
+func dirToGraph(dir string) (*graph, error) {
+	mod, err := loadModule(dir)
+	if err != nil {
+		if !needsHCL2(err) {
+			return nil, err
+		}
+		// the legacy loader can't parse terraform 0.12+ syntax, so retry with HCL2.  When that
+		// fails as well both are reported, HCL2 first as it carries precise positions.
+		thisGraph, hcl2Err := hcl2DirToGraph(dir)
+		if hcl2Err != nil {
+			return nil, &multierror.Error{Errors: []error{hcl2Err, err}}
+		}
+		return thisGraph, nil
+	}
+	thisGraph, err := moduleToGraph(mod)
+	if err != nil {
+		return nil, &stageError{Stage: stagePlan, Err: err}
+	}
+	return thisGraph, nil
+}
+
+// whether the legacy loader failed on syntax it doesn't know, like the first-class expressions of
+// terraform 0.12, or on a version constraint, rather than e.g. on fetching a module
+func needsHCL2(err error) bool {
+	for _, d := range newDiagnostics(stageLoad, err) {
+		if d.Pos != nil || strings.Contains(d.Err, "version") {
+			return true
+		}
+	}
+	return false
+}
+
+func hcl2DirToGraph(dir string) (*graph, error) {
+	instances, warnings, err := loadHCL2Dir(dir)
+	if err != nil {
+		return nil, &stageError{Stage: stageLoad, Err: err}
+	}
+	thisGraph, err := instancesToGraph(instances)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range warnings {
+		thisGraph.warn("%s", w)
+	}
+	return thisGraph, nil
+}
+// HclToCytoscape is the cytoscape JSON of a configuration given as hcl source
+func HclToCytoscape(hcl string) (string, error) {
+
+	//var cytoscapeData []cytoscapeNode
+
+	configuration, err := config.LoadJSON([]byte(hcl))
+	if err != nil {
+		return "", err
+	}
+
+	return ConfigToCytoscape(configuration)
+}
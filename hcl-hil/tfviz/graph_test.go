@@ -0,0 +1,83 @@
+package tfviz
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSecurityGroupRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		ingress  string
+		edges    string
+		warnings string
+	}{
+		{
+			"self",
+			`self = true`,
+			"aws_instance.a -> aws_instance.b, aws_instance.b -> aws_instance.a",
+			"",
+		},
+		{
+			"cidr block and self",
+			`cidr_blocks = ["192.168.0.0/24"]
+			 self        = true`,
+			"aws_instance.a -> aws_instance.b, aws_instance.b -> aws_instance.a",
+			"",
+		},
+		{
+			"ipv6 only",
+			`ipv6_cidr_blocks = ["::/0"]`,
+			"",
+			"aws_security_group.sg: ingress rule left out, it has no ipv4 cidr block, security group or self",
+		},
+	}
+	for _, tt := range tests {
+		dir, remove := writeConfig(t, `
+			resource "aws_vpc" "x" {
+			  cidr_block = "10.0.0.0/16"
+			}
+			resource "aws_subnet" "a" {
+			  vpc_id     = aws_vpc.x.id
+			  cidr_block = "10.0.0.0/24"
+			}
+			resource "aws_security_group" "sg" {
+			  vpc_id = aws_vpc.x.id
+			  ingress {
+			    from_port = 22
+			    to_port   = 22
+			    protocol  = "tcp"
+			    `+tt.ingress+`
+			  }
+			}
+			resource "aws_instance" "a" {
+			  subnet_id              = aws_subnet.a.id
+			  vpc_security_group_ids = [aws_security_group.sg.id]
+			}
+			resource "aws_instance" "b" {
+			  subnet_id              = aws_subnet.a.id
+			  vpc_security_group_ids = [aws_security_group.sg.id]
+			}`)
+		g, err := hcl2DirToGraph(dir)
+		remove()
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		var edges, warnings []string
+		for key := range g.Edges.Ports {
+			edges = append(edges, key)
+		}
+		sort.Strings(edges)
+		for _, w := range g.Warnings {
+			warnings = append(warnings, w.Err)
+		}
+		if got := strings.Join(edges, ", "); got != tt.edges {
+			t.Errorf("%s: edges = %q, want %q", tt.name, got, tt.edges)
+		}
+		if got := strings.Join(warnings, "\n"); got != tt.warnings {
+			t.Errorf("%s: warnings = %q, want %q", tt.name, got, tt.warnings)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package tfviz
+
+import (
+	"encoding/xml"
+	"strconv"
+)
+
+type graphmlFile struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphmlKey `xml:"key"`
+	Graph   graphmlGraph `xml:"graph"`
+}
+
+type graphmlKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphmlGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphmlNode `xml:"node"`
+	Edges       []graphmlEdge `xml:"edge"`
+}
+
+type graphmlNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// the attributes of the nodes and edges, ids and names alike
+var graphmlKeys = []graphmlKey{
+	{"name", "node", "name", "string"},
+	{"type", "node", "type", "string"},
+	{"module", "node", "module", "string"},
+	{"parent", "node", "parent", "string"},
+	{"cidr", "node", "cidr", "string"},
+	{"access", "node", "access", "string"},
+	{"kind", "edge", "kind", "string"},
+	{"direction", "edge", "direction", "string"},
+	{"ports", "edge", "ports", "string"},
+	{"blocked", "edge", "blocked", "string"},
+	{"replies_blocked", "edge", "replies_blocked", "boolean"},
+	{"label", "edge", "label", "string"},
+}
+
+// data for the attributes that have a value
+func graphmlValues(keyValues ...string) []graphmlData {
+	var data []graphmlData
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		if keyValues[i+1] != "" {
+			data = append(data, graphmlData{Key: keyValues[i], Value: keyValues[i+1]})
+		}
+	}
+	return data
+}
+
+// the graph in GraphML, for graph analysis tools.  Containment and reachability are both edges,
+// told apart by their kind.
+func graphmlXML(thisGraph *graph) (string, error) {
+	nodes, edges := analysisGraph(thisGraph)
+	g := graphmlGraph{ID: "terraform", EdgeDefault: "directed"}
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, graphmlNode{
+			ID:   n.ID,
+			Data: graphmlValues("name", n.Name, "type", n.Type, "module", n.Module, "parent", n.Parent, "cidr", n.Cidr, "access", n.Access),
+		})
+	}
+	for _, e := range edges {
+		var repliesBlocked string
+		if e.Kind == reachabilityEdge {
+			repliesBlocked = strconv.FormatBool(e.RepliesBlocked)
+		}
+		g.Edges = append(g.Edges, graphmlEdge{
+			ID:     e.ID,
+			Source: e.Source,
+			Target: e.Target,
+			Data: graphmlValues("kind", e.Kind, "direction", e.Direction, "ports", e.Ports, "blocked", e.Blocked,
+				"replies_blocked", repliesBlocked, "label", e.Label),
+		})
+	}
+	file := graphmlFile{Xmlns: "http://graphml.graphdrawing.org/xmlns", Keys: graphmlKeys, Graph: g}
+	byteArray, err := xml.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return "", &stageError{Stage: stageGraphBuild, Err: err}
+	}
+	return xml.Header + string(byteArray) + "\n", nil
+}
@@ -0,0 +1,142 @@
+package tfviz
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/openixia/terraform-visualizer/hcl-hil/handler"
+)
+
+// handlerProviders are the providers of the registered resource types, e.g. aws for aws_vpc,
+// which the terraform 0.11 plan needs to resolve
+func handlerProviders() []string {
+	var providers []string
+	for _, t := range handler.Types() {
+		provider := strings.SplitN(t, "_", 2)[0]
+		if !containsString(providers, provider) {
+			providers = append(providers, provider)
+		}
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// resourceHandler adapts a function evaluating a family of resource types.  Instances aren't
+// evaluated in any particular order beyond the dependencies between them, so a function that
+// needs every resource known has to record what it needs in the graph and finish the job in a
+// pass of finalizeGraph.
+type resourceHandler struct {
+	types  []string
+	handle func(ctx *handler.Context, info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error
+}
+
+func (h resourceHandler) Types() []string {
+	return h.types
+}
+
+func (h resourceHandler) Handle(ctx *handler.Context, r *handler.Resource) error {
+	return h.handle(ctx, &cytoInstanceInfo{II: r.Info, ID: r.ID}, r.Config, ctx.Graph.(*graph))
+}
+func init() {
+	handler.Register(resourceHandler{
+		types: []string{"aws_vpc", "aws_subnet", "aws_instance", "aws_network_interface", "aws_network_interface_attachment",
+			"aws_security_group", "aws_security_group_rule", "aws_elb"},
+		handle: func(ctx *handler.Context, info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+			return evalAwsResource(info, c, ctx.SecurityGroups, thisGraph)
+		},
+	})
+	handler.Register(resourceHandler{
+		types: []string{"aws_internet_gateway", "aws_nat_gateway", "aws_route_table", "aws_route", "aws_route_table_association",
+			"aws_main_route_table_association"},
+		handle: func(ctx *handler.Context, info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+			return evalRoutingResource(info, c, thisGraph)
+		},
+	})
+	handler.Register(resourceHandler{
+		types: []string{"aws_vpc_peering_connection", "aws_ec2_transit_gateway", "aws_ec2_transit_gateway_vpc_attachment",
+			"aws_ec2_transit_gateway_route", "aws_ec2_transit_gateway_route_table_association",
+			"aws_ec2_transit_gateway_route_table_propagation"},
+		handle: func(ctx *handler.Context, info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+			return evalPeeringResource(info, c, thisGraph)
+		},
+	})
+	handler.Register(resourceHandler{
+		types: []string{"aws_network_acl", "aws_default_network_acl", "aws_network_acl_rule", "aws_network_acl_association"},
+		handle: func(ctx *handler.Context, info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+			return evalNaclResource(info, c, thisGraph)
+		},
+	})
+	handler.Register(resourceHandler{
+		types: []string{"aws_lb", "aws_alb", "aws_lb_listener", "aws_alb_listener", "aws_lb_listener_rule", "aws_alb_listener_rule",
+			"aws_lb_target_group", "aws_alb_target_group", "aws_lb_target_group_attachment", "aws_alb_target_group_attachment"},
+		handle: func(ctx *handler.Context, info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+			return evalLoadBalancerResource(info, c, ctx.SecurityGroups, thisGraph)
+		},
+	})
+	handler.Register(resourceHandler{
+		types: []string{"aws_launch_configuration", "aws_launch_template", "aws_autoscaling_group"},
+		handle: func(ctx *handler.Context, info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+			return evalAutoscalingResource(info, c, ctx.SecurityGroups, thisGraph)
+		},
+	})
+	handler.Register(resourceHandler{
+		types: []string{"aws_db_subnet_group", "aws_db_instance", "aws_rds_cluster", "aws_rds_cluster_instance"},
+		handle: func(ctx *handler.Context, info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+			return evalRdsResource(info, c, ctx.SecurityGroups, thisGraph)
+		},
+	})
+	handler.Register(resourceHandler{
+		types: []string{"google_compute_network", "google_compute_subnetwork", "google_compute_instance", "google_compute_firewall"},
+		handle: func(ctx *handler.Context, info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+			return evalGoogleResource(info, c, thisGraph)
+		},
+	})
+	handler.Register(resourceHandler{
+		types: []string{"azurerm_virtual_network", "azurerm_subnet", "azurerm_network_security_group", "azurerm_network_security_rule",
+			"azurerm_subnet_network_security_group_association", "azurerm_network_interface_security_group_association",
+			"azurerm_network_interface", "azurerm_linux_virtual_machine", "azurerm_windows_virtual_machine"},
+		handle: func(ctx *handler.Context, info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+			return evalAzureResource(info, c, thisGraph)
+		},
+	})
+}
+
+// add the network nodes and reachability edges contributed by a single resource instance, with
+// the handler registered for its type.  g is the security group pathing graph shared by all the
+// resources of the configuration.
+func evalResource(info *cytoInstanceInfo, c *terraform.ResourceConfig, g *dag.Graph, thisGraph *graph) error {
+	h, ok := handler.Lookup(info.II.Type)
+	if !ok {
+		return nil // not part of the network
+	}
+	ctx := &handler.Context{Graph: thisGraph, Topology: thisGraph.Topology, SecurityGroups: g}
+	return h.Handle(ctx, &handler.Resource{ID: info.ID, Info: info.II, Config: c})
+}
+
+// Address implements handler.Graph
+func (g *graph) Address(r *handler.Resource, ref string) string {
+	return stripAttribute(r.Info, ref, "id")
+}
+
+// AddNode implements handler.Graph
+func (g *graph) AddNode(r *handler.Resource, parent string) error {
+	return g.addNode(&cytoInstanceInfo{II: r.Info, ID: r.ID}, r.Config, parent, 0)
+}
+
+// AddEdge implements handler.Graph
+func (g *graph) AddEdge(source string, target string, protocol string, from int, to int) error {
+	ports := rulePorts(map[string]interface{}{"protocol": protocol, "from_port": from, "to_port": to})
+	return g.addEdge(source, target, ports)
+}
+
+// JoinSecurityGroup implements handler.Graph
+func (g *graph) JoinSecurityGroup(r *handler.Resource, sg string) error {
+	return connectBySG(&cytoInstanceInfo{II: r.Info, ID: r.ID}, sg, g.SecurityGroups.Paths, g)
+}
+
+// JoinSubnet implements handler.Graph
+func (g *graph) JoinSubnet(r *handler.Resource, subnet string) error {
+	return connectByCidr(&cytoInstanceInfo{II: r.Info, ID: r.ID}, subnet, g.SecurityGroups.Paths, g)
+}
@@ -0,0 +1,111 @@
+package tfviz
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/openixia/terraform-visualizer/hcl-hil/handler"
+)
+
+// an in-house resource type, drawn in its subnet with the reachability of its security groups
+type queueHandler struct{}
+
+func (queueHandler) Types() []string { return []string{"mycorp_queue"} }
+
+func (queueHandler) Handle(ctx *handler.Context, r *handler.Resource) error {
+	subnet, _ := r.Config.Get("subnet_id")
+	parent := ctx.Graph.Address(r, subnet.(string))
+	if err := ctx.Graph.AddNode(r, parent); err != nil {
+		return err
+	}
+	if sgs, ok := r.Config.Get("security_group_ids"); ok {
+		for _, sg := range sgs.([]interface{}) {
+			if err := ctx.Graph.JoinSecurityGroup(r, ctx.Graph.Address(r, sg.(string))); err != nil {
+				return err
+			}
+		}
+	}
+	return ctx.Graph.JoinSubnet(r, parent)
+}
+
+func init() { handler.Register(queueHandler{}) }
+
+func TestHandlerReachability(t *testing.T) {
+	tests := []struct {
+		name  string
+		app   string // rule of the security group of the instance
+		queue string // attributes of the queue
+		edges string
+	}{
+		{
+			"security group",
+			``,
+			`security_group_ids = [aws_security_group.queue.id]`,
+			"aws_instance.a -> mycorp_queue.q: tcp/5672",
+		},
+		{
+			"cidr block",
+			`egress {
+			   from_port   = 443
+			   to_port     = 443
+			   protocol    = "tcp"
+			   cidr_blocks = ["10.0.1.0/24"]
+			 }`,
+			``,
+			"aws_instance.a -> mycorp_queue.q: tcp/443",
+		},
+	}
+	for _, tt := range tests {
+		dir, remove := writeConfig(t, `
+			resource "aws_vpc" "x" {
+			  cidr_block = "10.0.0.0/16"
+			}
+			resource "aws_subnet" "a" {
+			  vpc_id     = aws_vpc.x.id
+			  cidr_block = "10.0.0.0/24"
+			}
+			resource "aws_subnet" "b" {
+			  vpc_id     = aws_vpc.x.id
+			  cidr_block = "10.0.1.0/24"
+			}
+			resource "aws_security_group" "app" {
+			  vpc_id = aws_vpc.x.id
+			  `+tt.app+`
+			}
+			resource "aws_security_group" "queue" {
+			  vpc_id = aws_vpc.x.id
+			  ingress {
+			    from_port       = 5672
+			    to_port         = 5672
+			    protocol        = "tcp"
+			    security_groups = [aws_security_group.app.id]
+			  }
+			}
+			resource "aws_instance" "a" {
+			  subnet_id              = aws_subnet.a.id
+			  vpc_security_group_ids = [aws_security_group.app.id]
+			}
+			resource "mycorp_queue" "q" {
+			  subnet_id = aws_subnet.b.id
+			  `+tt.queue+`
+			}`)
+		g, err := hcl2DirToGraph(dir)
+		remove()
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if !g.Topology.Has("mycorp_queue.q") || g.Topology.Parent("mycorp_queue.q") != "aws_subnet.b" {
+			t.Errorf("%s: mycorp_queue.q not placed in aws_subnet.b", tt.name)
+		}
+		var edges []string
+		for key, ports := range g.Edges.Ports {
+			edges = append(edges, key+": "+strings.Join(ports.strings(), ", "))
+		}
+		sort.Strings(edges)
+		if got := strings.Join(edges, "\n"); got != tt.edges {
+			t.Errorf("%s: edges = %q, want %q", tt.name, got, tt.edges)
+		}
+	}
+}
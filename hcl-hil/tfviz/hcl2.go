@@ -0,0 +1,1046 @@
+package tfviz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/hcl2/hclparse"
+	"github.com/hashicorp/hil/ast"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Loader for terraform 0.12+ (HCL2) configurations.
+//
+// Rather than planning against a mock provider, the configuration is evaluated directly:
+// variables, locals, module inputs/outputs, count, for_each and dynamic blocks are resolved
+// with HCL2, as are the attributes resources are given, e.g. aws_vpc.main.cidr_block, while
+// references to other resources are rendered back into legacy interpolation syntax
+// ("${aws_subnet.a.0.id}") so the resulting resourceInstances go through evalResource exactly
+// like the legacy DiffFn does.
+//
+// limitation: only native syntax (.tf) files are read, override files are not merged, and
+// non-local module sources are only found if `terraform init` has recorded them in
+// .terraform/modules/modules.json.
+
+// roots of a traversal that never name a resource
+var hcl2ReservedRoots = map[string]bool{
+	"var":       true,
+	"local":     true,
+	"module":    true,
+	"count":     true,
+	"each":      true,
+	"path":      true,
+	"terraform": true,
+	"self":      true,
+}
+
+// resource and module arguments that are not part of the resource's own configuration
+var hcl2MetaArguments = map[string]bool{
+	"count":      true,
+	"for_each":   true,
+	"depends_on": true,
+	"provider":   true,
+	"providers":  true,
+	"source":     true,
+	"version":    true,
+}
+
+// hcl2Module is the parsed content of one module directory
+type hcl2Module struct {
+	path          []string // {"root", "child", ...}, as in terraform.InstanceInfo.ModulePath
+	dir           string
+	variables     map[string]*hclsyntax.Block
+	locals        map[string]*hclsyntax.Attribute
+	outputs       map[string]*hclsyntax.Block
+	moduleCalls   map[string]*hclsyntax.Block
+	resources     []*hclsyntax.Block
+	providers     []*hclsyntax.Block
+	resourceTypes map[string]bool
+}
+
+// hcl2Loader walks a module tree, collecting the resource instances of every module
+type hcl2Loader struct {
+	parser    *hclparse.Parser
+	rootDir   string
+	manifest  map[string]string // module key -> directory, written by terraform init
+	instances []*resourceInstance
+	diags     hcl.Diagnostics
+	warnings  []string // what the diagram will leave out, reported along with it
+}
+
+// hcl2Scope evaluates the expressions of one module instance
+type hcl2Scope struct {
+	loader  *hcl2Loader
+	mod     *hcl2Module
+	vars    map[string]cty.Value
+	locals  map[string]cty.Value
+	modules map[string]cty.Value
+	// instance keys of each resource in the module, so splats can be expanded, see instanceAddress
+	keys    map[string][]interface{}
+	configs map[string]map[string]interface{} // instance address -> its config, once evaluated
+	deps    []string                          // extra dependencies for every instance, from the module call's inputs
+	regions map[string]string                 // provider configuration, e.g. "aws" or "aws.west" -> its region, where known
+}
+
+func loadHCL2Dir(dir string) ([]*resourceInstance, []string, error) {
+	l := &hcl2Loader{
+		parser:  hclparse.NewParser(),
+		rootDir: dir,
+	}
+	l.readManifest()
+
+	mod := l.parseModule([]string{"root"}, dir)
+	if mod != nil && !l.diags.HasErrors() {
+		l.evalModule(mod, l.tfvars(), nil, nil)
+	}
+	if l.diags.HasErrors() {
+		return nil, nil, &hcl2Error{Stage: stageLoad, Diags: l.diags}
+	}
+	return l.instances, l.warnings, nil
+}
+
+func (l *hcl2Loader) warn(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+// hcl2Error carries HCL2 diagnostics through the error return of the loader
+type hcl2Error struct {
+	Stage string
+	Diags hcl.Diagnostics
+}
+
+func (e *hcl2Error) Error() string {
+	return e.Diags.Error()
+}
+
+func (e *hcl2Error) diagnostics() []*Diagnostic {
+	var diags []*Diagnostic
+	for _, d := range e.Diags {
+		if d.Severity != hcl.DiagError {
+			continue
+		}
+		diag := &Diagnostic{Stage: e.Stage, Err: d.Summary}
+		if d.Detail != "" {
+			diag.Err += ": " + d.Detail
+		}
+		if d.Subject != nil {
+			diag.Pos = &ast.Pos{
+				Filename: d.Subject.Filename,
+				Line:     d.Subject.Start.Line,
+				Column:   d.Subject.Start.Column,
+			}
+		}
+		diags = append(diags, diag)
+	}
+	return diags
+}
+
+func (l *hcl2Loader) readManifest() {
+	l.manifest = map[string]string{}
+	raw, err := ioutil.ReadFile(filepath.Join(l.rootDir, ".terraform", "modules", "modules.json"))
+	if err != nil {
+		return
+	}
+	var manifest struct {
+		Modules []struct {
+			Key string
+			Dir string
+		}
+	}
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		l.warn("ignoring unreadable module manifest: %s", err)
+		return
+	}
+	for _, m := range manifest.Modules {
+		l.manifest[m.Key] = filepath.Join(l.rootDir, m.Dir)
+	}
+}
+
+// variable values for the root module from terraform.tfvars and *.auto.tfvars
+func (l *hcl2Loader) tfvars() map[string]cty.Value {
+	vars := map[string]cty.Value{}
+	files, _ := filepath.Glob(filepath.Join(l.rootDir, "*.auto.tfvars"))
+	sort.Strings(files)
+	files = append([]string{filepath.Join(l.rootDir, "terraform.tfvars")}, files...)
+	for _, name := range files {
+		if _, err := os.Stat(name); err != nil {
+			continue
+		}
+		f, diags := l.parser.ParseHCLFile(name)
+		l.diags = append(l.diags, diags...)
+		if f == nil {
+			continue
+		}
+		attrs, diags := f.Body.JustAttributes()
+		l.diags = append(l.diags, diags...)
+		for varName, attr := range attrs {
+			v, diags := attr.Expr.Value(nil)
+			l.diags = append(l.diags, diags...)
+			vars[varName] = v
+		}
+	}
+	return vars
+}
+
+func (l *hcl2Loader) parseModule(path []string, dir string) *hcl2Module {
+	names, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil || len(names) == 0 {
+		l.diags = append(l.diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "No configuration files",
+			Detail:   fmt.Sprintf("%s contains no .tf files", dir),
+		})
+		return nil
+	}
+	sort.Strings(names)
+
+	mod := &hcl2Module{
+		path:          path,
+		dir:           dir,
+		variables:     map[string]*hclsyntax.Block{},
+		locals:        map[string]*hclsyntax.Attribute{},
+		outputs:       map[string]*hclsyntax.Block{},
+		moduleCalls:   map[string]*hclsyntax.Block{},
+		resourceTypes: map[string]bool{},
+	}
+	for _, name := range names {
+		base := filepath.Base(name)
+		if base == "override.tf" || strings.HasSuffix(base, "_override.tf") {
+			continue
+		}
+		f, diags := l.parser.ParseHCLFile(name)
+		l.diags = append(l.diags, diags...)
+		if f == nil {
+			continue
+		}
+		body := f.Body.(*hclsyntax.Body)
+		for _, block := range body.Blocks {
+			l.addBlock(mod, block)
+		}
+	}
+	return mod
+}
+
+func (l *hcl2Loader) addBlock(mod *hcl2Module, block *hclsyntax.Block) {
+	labels := map[string]int{
+		"variable": 1,
+		"output":   1,
+		"module":   1,
+		"provider": 1,
+		"resource": 2,
+		"data":     2,
+	}
+	if n, ok := labels[block.Type]; ok && len(block.Labels) != n {
+		l.diags = append(l.diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s block", block.Type),
+			Detail:   fmt.Sprintf("A %s block must have %d label(s).", block.Type, n),
+			Subject:  block.DefRange().Ptr(),
+		})
+		return
+	}
+
+	switch block.Type {
+	case "variable":
+		mod.variables[block.Labels[0]] = block
+	case "locals":
+		for name, attr := range block.Body.Attributes {
+			mod.locals[name] = attr
+		}
+	case "output":
+		mod.outputs[block.Labels[0]] = block
+	case "module":
+		mod.moduleCalls[block.Labels[0]] = block
+	case "provider":
+		mod.providers = append(mod.providers, block)
+	case "resource":
+		mod.resources = append(mod.resources, block)
+		mod.resourceTypes[block.Labels[0]] = true
+	}
+	// terraform and data blocks don't contribute nodes
+}
+
+// module key as used by the terraform init manifest, e.g. "network.subnets"
+func moduleKey(path []string) string {
+	return strings.Join(path[1:], ".")
+}
+
+// address prefix of the resources in a module, e.g. "module.network.subnets"
+func moduleAddress(path []string) string {
+	return "module." + moduleKey(path)
+}
+
+// evaluate a module instance, adding its resources to l.instances and returning its outputs.
+// regions are those of the provider configurations the module call passes down.
+func (l *hcl2Loader) evalModule(mod *hcl2Module, inputs map[string]cty.Value, deps []string, regions map[string]string) map[string]cty.Value {
+	s := &hcl2Scope{
+		loader:  l,
+		mod:     mod,
+		vars:    map[string]cty.Value{},
+		locals:  map[string]cty.Value{},
+		modules: map[string]cty.Value{},
+		keys:    map[string][]interface{}{},
+		configs: map[string]map[string]interface{}{},
+		deps:    deps,
+		regions: map[string]string{},
+	}
+	for name, block := range mod.variables {
+		s.vars[name] = cty.DynamicVal
+		if v, ok := inputs[name]; ok {
+			s.vars[name] = v
+		} else if attr, ok := block.Body.Attributes["default"]; ok {
+			if v, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+				s.vars[name] = v
+			}
+		}
+	}
+
+	// locals may use module outputs and module inputs may use locals, so evaluate the
+	// locals again once the child modules are done
+	s.evalLocals()
+	s.evalProviders(regions)
+	names := make([]string, 0, len(mod.moduleCalls))
+	for name := range mod.moduleCalls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.evalModuleCall(name, mod.moduleCalls[name])
+	}
+	s.evalLocals()
+
+	s.expandResources()
+
+	outputs := map[string]cty.Value{}
+	for name, block := range mod.outputs {
+		if attr, ok := block.Body.Attributes["value"]; ok {
+			outputs[name] = configToCty(s.value(attr.Expr, s.evalContext()))
+		}
+	}
+	return outputs
+}
+
+func (s *hcl2Scope) evalLocals() {
+	pending := map[string]*hclsyntax.Attribute{}
+	for name, attr := range s.mod.locals {
+		pending[name] = attr
+	}
+	for len(pending) > 0 {
+		progress := false
+		for name, attr := range pending {
+			ready := true
+			for _, t := range attr.Expr.Variables() {
+				if t.RootName() != "local" || len(t) < 2 {
+					continue
+				}
+				if a, ok := t[1].(hcl.TraverseAttr); ok && pending[a.Name] != nil && a.Name != name {
+					ready = false
+				}
+			}
+			if ready {
+				s.locals[name] = configToCty(s.value(attr.Expr, s.evalContext()))
+				delete(pending, name)
+				progress = true
+			}
+		}
+		if !progress {
+			// a reference cycle, evaluate what's left as best we can
+			for name, attr := range pending {
+				s.locals[name] = configToCty(s.value(attr.Expr, s.evalContext()))
+				delete(pending, name)
+			}
+		}
+	}
+}
+
+func (s *hcl2Scope) evalModuleCall(name string, block *hclsyntax.Block) {
+	l := s.loader
+	path := append(append([]string{}, s.mod.path...), name)
+	ctx := s.evalContext()
+
+	var source string
+	if attr, ok := block.Body.Attributes["source"]; ok {
+		if v, diags := attr.Expr.Value(nil); !diags.HasErrors() && v.Type() == cty.String {
+			source = v.AsString()
+		}
+	}
+	var dir string
+	if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+		dir = filepath.Join(s.mod.dir, source)
+	} else if d, ok := l.manifest[moduleKey(path)]; ok {
+		dir = d
+	} else {
+		l.warn("skipping module %s: %s has not been fetched by terraform init", moduleAddress(path), source)
+		return
+	}
+
+	child := l.parseModule(path, dir)
+	if child == nil {
+		return
+	}
+
+	inputs := map[string]cty.Value{}
+	deps := append([]string{}, s.deps...)
+	for argName, attr := range block.Body.Attributes {
+		if hcl2MetaArguments[argName] {
+			continue
+		}
+		inputs[argName] = configToCty(s.value(attr.Expr, ctx))
+		deps = append(deps, s.references(attr.Expr)...)
+	}
+	s.modules[name] = objectOf(l.evalModule(child, inputs, deps, s.childRegions(block)))
+}
+
+// the provider configuration a resource's provider argument, or either side of a module call's
+// providers argument, names, e.g. aws.west
+func providerConfigKey(expr hcl.Expression) (string, bool) {
+	if t, diags := hcl.AbsTraversalForExpr(expr); !diags.HasErrors() {
+		return renderTraversal(t)
+	}
+	// the quoted form terraform 0.11 used
+	if v, diags := expr.Value(nil); !diags.HasErrors() && v.Type() == cty.String {
+		return v.AsString(), true
+	}
+	return "", false
+}
+
+// record the regions of the provider configurations of the module: its own provider blocks,
+// over the ones passed in by the module call
+func (s *hcl2Scope) evalProviders(inherited map[string]string) {
+	for key, region := range inherited {
+		s.regions[key] = region
+	}
+	ctx := s.evalContext()
+	for _, block := range s.mod.providers {
+		key := block.Labels[0]
+		if attr, ok := block.Body.Attributes["alias"]; ok {
+			if v, diags := attr.Expr.Value(nil); !diags.HasErrors() && v.Type() == cty.String {
+				key += "." + v.AsString()
+			}
+		}
+		delete(s.regions, key)
+		if attr, ok := block.Body.Attributes["region"]; ok {
+			if v, diags := attr.Expr.Value(ctx); !diags.HasErrors() && v.IsKnown() && !v.IsNull() && v.Type() == cty.String {
+				s.regions[key] = v.AsString()
+			}
+		}
+	}
+}
+
+// the regions of the provider configurations a module call passes to its module: the ones its
+// providers argument maps, or else the default (unaliased) ones
+func (s *hcl2Scope) childRegions(block *hclsyntax.Block) map[string]string {
+	attr, ok := block.Body.Attributes["providers"]
+	if !ok {
+		return defaultProviders(s.regions)
+	}
+	regions := map[string]string{}
+	obj, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return regions
+	}
+	for _, item := range obj.Items {
+		child, ok1 := providerConfigKey(item.KeyExpr)
+		parent, ok2 := providerConfigKey(item.ValueExpr)
+		if region, ok := s.regions[parent]; ok1 && ok2 && ok {
+			regions[child] = region
+		}
+	}
+	return regions
+}
+
+// expand count and for_each into resource instances
+func (s *hcl2Scope) expandResources() {
+	type expansion struct {
+		block *hclsyntax.Block
+		keys  []interface{} // nil, a count index or a for_each key
+		each  map[string]cty.Value
+		refs  []string
+	}
+	var expansions []*expansion
+	ctx := s.evalContext()
+
+	// instance keys first, so splat expressions over any resource can be expanded
+	for _, block := range s.mod.resources {
+		e := &expansion{block: block, keys: []interface{}{nil}, refs: s.references(block.Body)}
+		if attr, ok := block.Body.Attributes["count"]; ok {
+			e.keys = nil
+			count := 1
+			if v, diags := attr.Expr.Value(ctx); !diags.HasErrors() && v.IsKnown() && v.Type() == cty.Number {
+				n, _ := v.AsBigFloat().Int64()
+				count = int(n)
+			}
+			for i := 0; i < count; i++ {
+				e.keys = append(e.keys, i)
+			}
+		} else if attr, ok := block.Body.Attributes["for_each"]; ok {
+			var keys []string
+			e.each = map[string]cty.Value{}
+			if v, diags := attr.Expr.Value(ctx); !diags.HasErrors() && v.IsWhollyKnown() && !v.IsNull() && v.CanIterateElements() {
+				for it := v.ElementIterator(); it.Next(); {
+					k, ev := it.Element()
+					if !v.Type().IsMapType() && !v.Type().IsObjectType() {
+						// sets, and lists that should have been passed through toset()
+						k = ev
+					}
+					if k.Type() != cty.String {
+						continue
+					}
+					keys = append(keys, k.AsString())
+					e.each[k.AsString()] = ev
+				}
+				sort.Strings(keys)
+				e.keys = nil
+				for _, k := range keys {
+					e.keys = append(e.keys, k)
+				}
+			} else {
+				// unknown until apply: draw a single instance
+				e.each[""] = cty.DynamicVal
+			}
+		}
+		s.keys[block.Labels[0]+"."+block.Labels[1]] = e.keys
+		expansions = append(expansions, e)
+	}
+
+	expand := func(e *expansion) {
+		typ, name := e.block.Labels[0], e.block.Labels[1]
+		resource := typ + "." + name
+		deps := append(append([]string{}, e.refs...), s.deps...)
+		provider := strings.SplitN(typ, "_", 2)[0]
+		if attr, ok := e.block.Body.Attributes["provider"]; ok {
+			if key, ok := providerConfigKey(attr.Expr); ok {
+				provider = key
+			}
+		}
+
+		for _, key := range e.keys {
+			instCtx := ctx.NewChild()
+			instCtx.Variables = map[string]cty.Value{}
+			switch k := key.(type) {
+			case int:
+				instCtx.Variables["count"] = cty.ObjectVal(map[string]cty.Value{
+					"index": cty.NumberIntVal(int64(k)),
+				})
+			case string:
+				instCtx.Variables["each"] = cty.ObjectVal(map[string]cty.Value{
+					"key":   cty.StringVal(k),
+					"value": e.each[k],
+				})
+			default:
+				if e.each != nil {
+					instCtx.Variables["each"] = cty.ObjectVal(map[string]cty.Value{
+						"key":   cty.StringVal(""),
+						"value": e.each[""],
+					})
+				}
+			}
+
+			cfg := s.bodyConfig(e.block.Body, instCtx)
+			s.configs[instanceAddress(resource, key)] = cfg
+			s.loader.instances = append(s.loader.instances, &resourceInstance{
+				Info: &terraform.InstanceInfo{
+					Id:         instanceAddress(resource, key),
+					ModulePath: s.mod.path,
+					Type:       typ,
+				},
+				Resource:  modulePath(s.mod.path, resource),
+				Config:    cfg,
+				DependsOn: deps,
+				Region:    s.regions[provider],
+			})
+		}
+	}
+
+	// the resources others reference first, so the attributes they know can be used, e.g.
+	// cidrsubnet(aws_vpc.main.cidr_block, 8, 1).  Like locals, a cycle is evaluated as best we can.
+	byResource := map[string]*expansion{}
+	for _, e := range expansions {
+		byResource[modulePath(s.mod.path, e.block.Labels[0]+"."+e.block.Labels[1])] = e
+	}
+	pending := map[*expansion]bool{}
+	for _, e := range expansions {
+		pending[e] = true
+	}
+	for len(pending) > 0 {
+		progress := false
+		for _, e := range expansions {
+			if !pending[e] {
+				continue
+			}
+			ready := true
+			for _, ref := range e.refs {
+				if d := byResource[ref]; d != nil && d != e && pending[d] {
+					ready = false
+				}
+			}
+			if ready {
+				expand(e)
+				delete(pending, e)
+				progress = true
+			}
+		}
+		if !progress {
+			for _, e := range expansions {
+				if pending[e] {
+					expand(e)
+					delete(pending, e)
+				}
+			}
+		}
+	}
+}
+
+func (s *hcl2Scope) evalContext() *hcl.EvalContext {
+	return &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"var":    objectOf(s.vars),
+			"local":  objectOf(s.locals),
+			"module": objectOf(s.modules),
+			"path": cty.ObjectVal(map[string]cty.Value{
+				"module": cty.StringVal(s.mod.dir),
+				"root":   cty.StringVal(s.loader.rootDir),
+				"cwd":    cty.StringVal(s.loader.rootDir),
+			}),
+			"terraform": cty.ObjectVal(map[string]cty.Value{
+				"workspace": cty.StringVal("default"),
+			}),
+		},
+		Functions: hcl2Functions,
+	}
+}
+
+func objectOf(attrs map[string]cty.Value) cty.Value {
+	if len(attrs) == 0 {
+		return cty.EmptyObjectVal
+	}
+	return cty.ObjectVal(attrs)
+}
+
+// addresses of the resources and modules referenced anywhere in node
+func (s *hcl2Scope) references(node hclsyntax.Node) []string {
+	var refs []string
+	hclsyntax.VisitAll(node, func(n hclsyntax.Node) hcl.Diagnostics {
+		expr, ok := n.(*hclsyntax.ScopeTraversalExpr)
+		if !ok {
+			return nil
+		}
+		t := expr.Traversal
+		switch root := t.RootName(); {
+		case root == "module" && len(t) > 1:
+			if a, ok := t[1].(hcl.TraverseAttr); ok {
+				refs = append(refs, moduleAddress(append(append([]string{}, s.mod.path...), a.Name)))
+			}
+		case s.mod.resourceTypes[root] && len(t) > 1:
+			if a, ok := t[1].(hcl.TraverseAttr); ok {
+				refs = append(refs, modulePath(s.mod.path, root+"."+a.Name))
+			}
+		}
+		return nil
+	})
+	return refs
+}
+
+// convert a resource body into the map[string]interface{} the legacy loader would produce
+func (s *hcl2Scope) bodyConfig(body *hclsyntax.Body, ctx *hcl.EvalContext) map[string]interface{} {
+	cfg := map[string]interface{}{}
+	for name, attr := range body.Attributes {
+		if hcl2MetaArguments[name] {
+			continue
+		}
+		if v := s.value(attr.Expr, ctx); v != nil {
+			cfg[name] = v
+		}
+	}
+	for _, block := range body.Blocks {
+		switch block.Type {
+		case "lifecycle", "provisioner", "connection":
+		case "dynamic":
+			s.dynamicBlocks(cfg, block, ctx)
+		default:
+			cfg[block.Type] = append(blockList(cfg[block.Type]), s.bodyConfig(block.Body, ctx))
+		}
+	}
+	return cfg
+}
+
+func blockList(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+	return nil
+}
+
+// expand a dynamic "name" { for_each = ...  content { ... } } block into name blocks
+func (s *hcl2Scope) dynamicBlocks(cfg map[string]interface{}, block *hclsyntax.Block, ctx *hcl.EvalContext) {
+	if len(block.Labels) != 1 {
+		return
+	}
+	name := block.Labels[0]
+	iterator := name
+	if attr, ok := block.Body.Attributes["iterator"]; ok {
+		iterator = hcl.ExprAsKeyword(attr.Expr)
+	}
+	var content *hclsyntax.Block
+	for _, b := range block.Body.Blocks {
+		if b.Type == "content" {
+			content = b
+		}
+	}
+	attr, ok := block.Body.Attributes["for_each"]
+	if content == nil || !ok {
+		return
+	}
+	forEach, diags := attr.Expr.Value(ctx)
+	if diags.HasErrors() || !forEach.IsWhollyKnown() || forEach.IsNull() || !forEach.CanIterateElements() {
+		r := attr.Expr.Range()
+		s.loader.warn("%s:%d: cannot expand dynamic %s block: for_each is not known", r.Filename, r.Start.Line, name)
+		return
+	}
+	for it := forEach.ElementIterator(); it.Next(); {
+		k, v := it.Element()
+		child := ctx.NewChild()
+		child.Variables = map[string]cty.Value{
+			iterator: cty.ObjectVal(map[string]cty.Value{"key": k, "value": v}),
+		}
+		cfg[name] = append(blockList(cfg[name]), s.bodyConfig(content.Body, child))
+	}
+}
+
+// evaluate expr to a plain go value.  Resource references become interpolation strings and
+// anything that cannot be evaluated is kept as its source text, like interpolateRawConfig
+// puts back computed values.
+func (s *hcl2Scope) value(expr hclsyntax.Expression, ctx *hcl.EvalContext) interface{} {
+	if ref, ok := s.reference(expr, ctx); ok {
+		// an attribute the resource was given, e.g. aws_vpc.main.cidr_block, is used as is, but
+		// whole resources, the ids only known after apply and names stay references to follow
+		if !strings.HasSuffix(ref, ".name") {
+			if v, ok := s.known(expr, ctx); ok && !v.Type().IsObjectType() {
+				return ctyToConfig(v)
+			}
+		}
+		return "${" + ref + "}"
+	}
+
+	switch e := expr.(type) {
+	case *hclsyntax.TemplateWrapExpr:
+		return s.value(e.Wrapped, ctx)
+	case *hclsyntax.TupleConsExpr:
+		list := []interface{}{}
+		for _, item := range e.Exprs {
+			list = append(list, s.value(item, ctx))
+		}
+		return list
+	case *hclsyntax.ObjectConsExpr:
+		m := map[string]interface{}{}
+		for _, item := range e.Items {
+			k, diags := item.KeyExpr.Value(ctx)
+			if diags.HasErrors() || !k.IsKnown() || k.Type() != cty.String {
+				continue
+			}
+			m[k.AsString()] = s.value(item.ValueExpr, ctx)
+		}
+		return m
+	case *hclsyntax.ConditionalExpr:
+		cond, diags := e.Condition.Value(ctx)
+		if !diags.HasErrors() && cond.IsKnown() && cond.Type() == cty.Bool {
+			if cond.True() {
+				return s.value(e.TrueResult, ctx)
+			}
+			return s.value(e.FalseResult, ctx)
+		}
+	case *hclsyntax.SplatExpr:
+		if list, ok := s.splat(e, ctx); ok {
+			return list
+		}
+	case *hclsyntax.FunctionCallExpr:
+		if v, ok := s.known(e, ctx); ok {
+			return ctyToConfig(v)
+		}
+		// arguments may hold resource references, which are plain strings by now
+		if f, ok := lookupFunction(ctx, e.Name); ok && !e.ExpandFinal {
+			args := make([]cty.Value, len(e.Args))
+			for i, arg := range e.Args {
+				args[i] = configToCty(s.value(arg, ctx))
+			}
+			if v, err := f.Call(args); err == nil && v.IsWhollyKnown() {
+				return ctyToConfig(v)
+			}
+		}
+	}
+
+	v, ok := s.known(expr, ctx)
+	if !ok {
+		return "${" + s.source(expr) + "}"
+	}
+	return ctyToConfig(v)
+}
+
+// the value of expr when everything it uses is known, including the attributes of the
+// resources of the module evaluated so far
+func (s *hcl2Scope) known(expr hclsyntax.Expression, ctx *hcl.EvalContext) (cty.Value, bool) {
+	v, diags := expr.Value(s.resourceContext(expr, ctx))
+	return v, !diags.HasErrors() && v.IsWhollyKnown()
+}
+
+// a child of ctx with the resources expr references, as far as they are evaluated
+func (s *hcl2Scope) resourceContext(expr hclsyntax.Expression, ctx *hcl.EvalContext) *hcl.EvalContext {
+	vars := map[string]cty.Value{}
+	for _, t := range expr.Variables() {
+		root := t.RootName()
+		if _, ok := vars[root]; ok || !s.mod.resourceTypes[root] || definedIn(ctx, root) {
+			continue
+		}
+		resources := map[string]cty.Value{}
+		for resource, keys := range s.keys {
+			parts := strings.SplitN(resource, ".", 2)
+			if parts[0] != root {
+				continue
+			}
+			if v, ok := s.resourceValue(resource, keys); ok {
+				resources[parts[1]] = v
+			}
+		}
+		vars[root] = objectOf(resources)
+	}
+	child := ctx.NewChild()
+	child.Variables = vars
+	return child
+}
+
+// the configs of the instances of a resource: an object for a single instance, a tuple for
+// count and an object by key for for_each.  false until every instance is evaluated.
+func (s *hcl2Scope) resourceValue(resource string, keys []interface{}) (cty.Value, bool) {
+	var list []cty.Value
+	byKey := map[string]cty.Value{}
+	for _, key := range keys {
+		cfg, ok := s.configs[instanceAddress(resource, key)]
+		if !ok {
+			return cty.NilVal, false
+		}
+		v := configToCty(cfg)
+		switch k := key.(type) {
+		case int:
+			list = append(list, v)
+		case string:
+			byKey[k] = v
+		default:
+			return v, true
+		}
+	}
+	if len(byKey) > 0 {
+		return cty.ObjectVal(byKey), true
+	}
+	if len(list) == 0 {
+		return cty.EmptyTupleVal, true
+	}
+	return cty.TupleVal(list), true
+}
+
+// render a reference to a resource (or data source) in legacy interpolation form, e.g.
+// aws_subnet.a[count.index].id -> aws_subnet.a[2].id
+func (s *hcl2Scope) reference(expr hclsyntax.Expression, ctx *hcl.EvalContext) (string, bool) {
+	switch e := expr.(type) {
+	case *hclsyntax.ScopeTraversalExpr:
+		root := e.Traversal.RootName()
+		if hcl2ReservedRoots[root] || !(s.mod.resourceTypes[root] || root == "data") || definedIn(ctx, root) {
+			return "", false
+		}
+		if ref, ok := renderTraversal(e.Traversal); ok {
+			return modulePath(s.mod.path, ref), true
+		}
+	case *hclsyntax.RelativeTraversalExpr:
+		if base, ok := s.reference(e.Source, ctx); ok {
+			if rel, ok := renderTraversal(e.Traversal); ok {
+				return base + rel, true
+			}
+		}
+	case *hclsyntax.IndexExpr:
+		if base, ok := s.reference(e.Collection, ctx); ok {
+			key, diags := e.Key.Value(ctx)
+			if k, ok := renderKey(key); ok && !diags.HasErrors() {
+				return base + k, true
+			}
+		}
+	}
+	return "", false
+}
+
+// aws_subnet.a.*.id -> ["${aws_subnet.a[0].id}", "${aws_subnet.a[1].id}", ...]
+func (s *hcl2Scope) splat(e *hclsyntax.SplatExpr, ctx *hcl.EvalContext) ([]interface{}, bool) {
+	src, ok := e.Source.(*hclsyntax.ScopeTraversalExpr)
+	if !ok || len(src.Traversal) != 2 {
+		return nil, false
+	}
+	name, ok := src.Traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return nil, false
+	}
+	base, ok := s.reference(src, ctx)
+	if !ok {
+		return nil, false
+	}
+	keys, ok := s.keys[src.Traversal.RootName()+"."+name.Name]
+	if !ok {
+		return nil, false
+	}
+	var each string
+	if rel, ok := e.Each.(*hclsyntax.RelativeTraversalExpr); ok {
+		if each, ok = renderTraversal(rel.Traversal); !ok {
+			return nil, false
+		}
+	}
+	list := []interface{}{}
+	for _, key := range keys {
+		list = append(list, "${"+instanceAddress(base, key)+each+"}")
+	}
+	return list, true
+}
+
+// look up a function in ctx or, like hcl does, the contexts it is a child of
+func lookupFunction(ctx *hcl.EvalContext, name string) (function.Function, bool) {
+	for ; ctx != nil; ctx = ctx.Parent() {
+		if f, ok := ctx.Functions[name]; ok {
+			return f, true
+		}
+	}
+	return function.Function{}, false
+}
+
+func definedIn(ctx *hcl.EvalContext, name string) bool {
+	for ; ctx != nil; ctx = ctx.Parent() {
+		if _, ok := ctx.Variables[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func renderTraversal(t hcl.Traversal) (string, bool) {
+	rendered := ""
+	for _, step := range t {
+		switch st := step.(type) {
+		case hcl.TraverseRoot:
+			rendered += st.Name
+		case hcl.TraverseAttr:
+			rendered += "." + st.Name
+		case hcl.TraverseIndex:
+			k, ok := renderKey(st.Key)
+			if !ok {
+				return "", false
+			}
+			rendered += k
+		default:
+			return "", false
+		}
+	}
+	return rendered, true
+}
+
+// render an index, e.g. [2] or ["a"]
+func renderKey(key cty.Value) (string, bool) {
+	if !key.IsKnown() || key.IsNull() {
+		return "", false
+	}
+	switch key.Type() {
+	case cty.String:
+		return instanceAddress("", key.AsString()), true
+	case cty.Number:
+		n, _ := key.AsBigFloat().Int64()
+		return instanceAddress("", int(n)), true
+	}
+	return "", false
+}
+
+func (s *hcl2Scope) source(expr hclsyntax.Expression) string {
+	rng := expr.Range()
+	src, ok := s.loader.parser.Sources()[rng.Filename]
+	if !ok || rng.End.Byte > len(src) {
+		return ""
+	}
+	return string(src[rng.Start.Byte:rng.End.Byte])
+}
+
+// convert a known cty value into the go types of the legacy config
+func ctyToConfig(v cty.Value) interface{} {
+	if v.IsNull() || !v.IsKnown() {
+		return nil
+	}
+	t := v.Type()
+	switch {
+	case t == cty.String:
+		return v.AsString()
+	case t == cty.Number:
+		bf := v.AsBigFloat()
+		if bf.IsInt() {
+			n, _ := bf.Int64()
+			return int(n)
+		}
+		f, _ := bf.Float64()
+		return f
+	case t == cty.Bool:
+		return v.True()
+	case t.IsListType() || t.IsSetType() || t.IsTupleType():
+		list := []interface{}{}
+		for it := v.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			list = append(list, ctyToConfig(ev))
+		}
+		return list
+	case t.IsMapType() || t.IsObjectType():
+		m := map[string]interface{}{}
+		for it := v.ElementIterator(); it.Next(); {
+			k, ev := it.Element()
+			if ev := ctyToConfig(ev); ev != nil {
+				m[k.AsString()] = ev
+			}
+		}
+		return m
+	}
+	return nil
+}
+
+// the reverse of ctyToConfig, so resolved values can be put back into an EvalContext
+func configToCty(v interface{}) cty.Value {
+	switch t := v.(type) {
+	case string:
+		return cty.StringVal(t)
+	case int:
+		return cty.NumberIntVal(int64(t))
+	case float64:
+		return cty.NumberFloatVal(t)
+	case bool:
+		return cty.BoolVal(t)
+	case []interface{}:
+		if len(t) == 0 {
+			return cty.EmptyTupleVal
+		}
+		vals := make([]cty.Value, len(t))
+		for i, e := range t {
+			vals[i] = configToCty(e)
+		}
+		return cty.TupleVal(vals)
+	case []map[string]interface{}:
+		list := make([]interface{}, len(t))
+		for i, e := range t {
+			list[i] = e
+		}
+		return configToCty(list)
+	case map[string]interface{}:
+		attrs := make(map[string]cty.Value, len(t))
+		for k, e := range t {
+			attrs[k] = configToCty(e)
+		}
+		return objectOf(attrs)
+	}
+	return cty.NullVal(cty.DynamicPseudoType)
+}
@@ -0,0 +1,141 @@
+package tfviz
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/apparentlymart/go-cidr/cidr"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// the subset of the terraform language functions commonly used to compute network layouts.
+// Calls to anything else leave the expression unevaluated.
+var hcl2Functions = map[string]function.Function{
+	"cidrhost":   cidrHostFunc,
+	"cidrsubnet": cidrSubnetFunc,
+	"coalesce":   stdlib.CoalesceFunc,
+	"concat":     stdlib.ConcatFunc,
+	"element":    elementFunc,
+	"format":     stdlib.FormatFunc,
+	"formatlist": stdlib.FormatListFunc,
+	"jsondecode": stdlib.JSONDecodeFunc,
+	"jsonencode": stdlib.JSONEncodeFunc,
+	"length":     lengthFunc,
+	"lookup":     lookupFunc,
+	"lower":      stdlib.LowerFunc,
+	"max":        stdlib.MaxFunc,
+	"min":        stdlib.MinFunc,
+	"tolist":     identityFunc,
+	"toset":      identityFunc,
+	"upper":      stdlib.UpperFunc,
+}
+
+func intArg(v cty.Value) int {
+	n, _ := v.AsBigFloat().Int64()
+	return int(n)
+}
+
+var elementFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "list", Type: cty.DynamicPseudoType},
+		{Name: "index", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		list := args[0]
+		if !list.CanIterateElements() || list.LengthInt() == 0 {
+			return cty.NilVal, errors.New("element() needs a non-empty list")
+		}
+		return list.Index(cty.NumberIntVal(int64(intArg(args[1]) % list.LengthInt()))), nil
+	},
+})
+
+var lengthFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "value", Type: cty.DynamicPseudoType},
+	},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		v := args[0]
+		switch {
+		case v.Type() == cty.String:
+			return cty.NumberIntVal(int64(len(v.AsString()))), nil
+		case v.CanIterateElements():
+			return cty.NumberIntVal(int64(v.LengthInt())), nil
+		}
+		return cty.NilVal, fmt.Errorf("cannot take the length of %s", v.Type().FriendlyName())
+	},
+})
+
+var lookupFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "map", Type: cty.DynamicPseudoType},
+		{Name: "key", Type: cty.String},
+	},
+	VarParam: &function.Parameter{Name: "default", Type: cty.DynamicPseudoType},
+	Type:     function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		m, key := args[0], args[1].AsString()
+		switch {
+		case m.Type().IsObjectType() && m.Type().HasAttribute(key):
+			return m.GetAttr(key), nil
+		case m.Type().IsMapType() && m.HasIndex(args[1]).True():
+			return m.Index(args[1]), nil
+		case len(args) > 2:
+			return args[2], nil
+		}
+		return cty.NilVal, fmt.Errorf("lookup failed to find %q", key)
+	},
+})
+
+var identityFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "value", Type: cty.DynamicPseudoType},
+	},
+	Type: function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return args[0], nil
+	},
+})
+
+var cidrSubnetFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "newbits", Type: cty.Number},
+		{Name: "netnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		_, network, err := net.ParseCIDR(args[0].AsString())
+		if err != nil {
+			return cty.NilVal, err
+		}
+		subnet, err := cidr.Subnet(network, intArg(args[1]), intArg(args[2]))
+		if err != nil {
+			return cty.NilVal, err
+		}
+		return cty.StringVal(subnet.String()), nil
+	},
+})
+
+var cidrHostFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "hostnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		_, network, err := net.ParseCIDR(args[0].AsString())
+		if err != nil {
+			return cty.NilVal, err
+		}
+		ip, err := cidr.Host(network, intArg(args[1]))
+		if err != nil {
+			return cty.NilVal, err
+		}
+		return cty.StringVal(ip.String()), nil
+	},
+})
@@ -0,0 +1,164 @@
+package tfviz
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a directory holding main.tf, removed when the test is done
+func writeConfig(t *testing.T, tf string) (string, func()) {
+	dir, err := ioutil.TempDir("", "tfviz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(tf), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestHCL2References(t *testing.T) {
+	tests := []struct {
+		name      string
+		tf        string
+		address   string
+		attribute string
+		want      interface{}
+	}{
+		{
+			"function of an attribute",
+			`resource "aws_subnet" "a" {
+			   vpc_id     = aws_vpc.x.id
+			   cidr_block = cidrsubnet(aws_vpc.x.cidr_block, 8, 1)
+			 }
+			 resource "aws_vpc" "x" {
+			   cidr_block = "10.0.0.0/16"
+			 }`,
+			"aws_subnet.a", "cidr_block", "10.0.1.0/24",
+		},
+		{
+			"attribute",
+			`resource "aws_vpc" "x" {
+			   cidr_block = "10.0.0.0/16"
+			 }
+			 resource "aws_security_group" "sg" {
+			   ingress {
+			     from_port   = 22
+			     to_port     = 22
+			     protocol    = "tcp"
+			     cidr_blocks = [aws_vpc.x.cidr_block]
+			   }
+			 }`,
+			"aws_security_group.sg", "ingress", []interface{}{map[string]interface{}{
+				"from_port": 22, "to_port": 22, "protocol": "tcp", "cidr_blocks": []interface{}{"10.0.0.0/16"},
+			}},
+		},
+		{
+			"attribute of a counted instance",
+			`resource "aws_subnet" "a" {
+			   count      = 2
+			   cidr_block = "10.0.${count.index}.0/24"
+			 }
+			 resource "aws_subnet" "b" {
+			   cidr_block = cidrsubnet(aws_subnet.a[1].cidr_block, 4, 3)
+			 }`,
+			"aws_subnet.b", "cidr_block", "10.0.1.48/28",
+		},
+		{
+			"id only known after apply",
+			`resource "aws_vpc" "x" {
+			   cidr_block = "10.0.0.0/16"
+			 }
+			 resource "aws_subnet" "a" {
+			   vpc_id = aws_vpc.x.id
+			 }`,
+			"aws_subnet.a", "vpc_id", "${aws_vpc.x.id}",
+		},
+		{
+			"name",
+			`resource "google_compute_network" "vpc" {
+			   name = "vpc"
+			 }
+			 resource "google_compute_subnetwork" "a" {
+			   network = google_compute_network.vpc.name
+			 }`,
+			"google_compute_subnetwork.a", "network", "${google_compute_network.vpc.name}",
+		},
+		{
+			"attribute only known after apply",
+			`resource "aws_subnet" "a" {
+			   cidr_block = cidrsubnet(aws_vpc.x.cidr_block, 8, 1)
+			 }
+			 resource "aws_vpc" "x" {
+			   cidr_block = data.aws_vpc.shared.cidr_block
+			 }`,
+			"aws_subnet.a", "cidr_block", "${cidrsubnet(aws_vpc.x.cidr_block, 8, 1)}",
+		},
+	}
+	for _, tt := range tests {
+		dir, remove := writeConfig(t, tt.tf)
+		instances, _, err := loadHCL2Dir(dir)
+		remove()
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		var got interface{}
+		for _, inst := range instances {
+			if inst.Info.HumanId() == tt.address {
+				got = inst.Config[tt.attribute]
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %s.%s = %#v, want %#v", tt.name, tt.address, tt.attribute, got, tt.want)
+		}
+	}
+}
+
+func TestHCL2UnknownCidr(t *testing.T) {
+	dir, remove := writeConfig(t, `
+		resource "aws_vpc" "x" {
+		  cidr_block = data.aws_vpc.shared.cidr_block
+		}
+		resource "aws_subnet" "a" {
+		  vpc_id     = aws_vpc.x.id
+		  cidr_block = cidrsubnet(aws_vpc.x.cidr_block, 8, 1)
+		}
+		resource "aws_security_group" "sg" {
+		  ingress {
+		    from_port   = 22
+		    to_port     = 22
+		    protocol    = "tcp"
+		    cidr_blocks = [aws_vpc.x.cidr_block]
+		  }
+		}
+		resource "aws_instance" "web" {
+		  subnet_id              = aws_subnet.a.id
+		  vpc_security_group_ids = [aws_security_group.sg.id]
+		}`)
+	defer remove()
+
+	g, err := hcl2DirToGraph(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.Topology.Has("aws_instance.web") {
+		t.Error("aws_instance.web isn't drawn")
+	}
+	var warnings []string
+	for _, w := range g.Warnings {
+		warnings = append(warnings, w.Err)
+	}
+	want := []string{
+		"aws_security_group.sg: ingress rule left out, cidr block data.aws_vpc.shared.cidr_block is not known",
+		"aws_subnet.a: cidr block cidrsubnet(aws_vpc.x.cidr_block, 8, 1) is not known, rules by cidr block leave it out",
+	}
+	if strings.Join(warnings, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings = %q, want %q", warnings, want)
+	}
+}
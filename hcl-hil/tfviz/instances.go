@@ -0,0 +1,214 @@
+package tfviz
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// resourceInstance is a resource instance whose configuration was resolved without running
+// a terraform plan.  References to other resources are kept in interpolation syntax, e.g.
+// "${aws_vpc.main.id}", so evalResource can treat it like the legacy DiffFn config.  Unlike
+// the DiffFn config, references are already qualified with their module path, since a value
+// passed through a module variable can point at a resource in any module.
+type resourceInstance struct {
+	Info      *terraform.InstanceInfo
+	Resource  string // address of the resource, without the instance key
+	Config    map[string]interface{}
+	DependsOn []string // addresses of the resources, instances or modules referenced by Config
+	Region    string   // region of the provider configuration of the resource, if known
+}
+
+// the addresses a reference to inst can be written as: its own, its resource's and the ones of
+// the modules it is in, e.g. module.net for module.net.aws_vpc.main
+func (inst *resourceInstance) addresses() []string {
+	id := inst.Info.HumanId()
+	addresses := []string{id, inst.Resource}
+	for i, c := range id {
+		if c == '.' {
+			addresses = append(addresses, id[:i])
+		}
+	}
+	return addresses
+}
+
+// order instances so everything an instance references is evaluated before it, like the
+// terraform graph walk orders the DiffFn calls.  Ties and cycles fall back to address order.
+func sortInstances(instances []*resourceInstance) []*resourceInstance {
+	pending := make([]*resourceInstance, len(instances))
+	copy(pending, instances)
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Info.HumanId() < pending[j].Info.HumanId()
+	})
+
+	// address -> the instances it refers to, by position in pending
+	byAddress := map[string][]int{}
+	for i, inst := range pending {
+		for _, address := range inst.addresses() {
+			if refs := byAddress[address]; len(refs) == 0 || refs[len(refs)-1] != i {
+				byAddress[address] = append(refs, i)
+			}
+		}
+	}
+	waitingOn := make([]int, len(pending))    // instance -> the instances it still waits for
+	dependents := make([][]int, len(pending)) // instance -> the instances waiting for it
+	for i, inst := range pending {
+		seen := map[int]bool{}
+		for _, d := range inst.DependsOn {
+			for _, j := range byAddress[d] {
+				if j != i && !seen[j] {
+					seen[j] = true
+					waitingOn[i]++
+					dependents[j] = append(dependents[j], i)
+				}
+			}
+		}
+	}
+
+	// Kahn's algorithm, taking the first ready instance in address order
+	ready := &indexHeap{}
+	for i := range pending {
+		if waitingOn[i] == 0 {
+			heap.Push(ready, i)
+		}
+	}
+	done := make([]bool, len(pending))
+	first := 0 // the first instance not done, taken when a cycle leaves none ready
+	var sorted []*resourceInstance
+	for len(sorted) < len(pending) {
+		next := -1
+		for ready.Len() > 0 {
+			if i := heap.Pop(ready).(int); !done[i] {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			for done[first] {
+				first++
+			}
+			next = first
+		}
+		done[next] = true
+		sorted = append(sorted, pending[next])
+		for _, i := range dependents[next] {
+			if waitingOn[i]--; waitingOn[i] == 0 && !done[i] {
+				heap.Push(ready, i)
+			}
+		}
+	}
+	return sorted
+}
+
+// indexHeap is a min-heap of positions
+type indexHeap []int
+
+func (h indexHeap) Len() int            { return len(h) }
+func (h indexHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h indexHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *indexHeap) Push(x interface{}) { *h = append(*h, x.(int)) }
+func (h *indexHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// normalizeConfig converts decoded values into the shapes the legacy config loader produces,
+// which is what evalResource type-asserts against: nested blocks become []map[string]interface{}
+// and whole numbers become int.  Empty lists are dropped like nil values, as the legacy loader
+// leaves out blocks that aren't set.
+func normalizeConfig(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			if list, ok := e.([]interface{}); e == nil || ok && len(list) == 0 {
+				continue
+			}
+			m[k] = normalizeConfig(e)
+		}
+		return m
+	case []map[string]interface{}:
+		blocks := make([]map[string]interface{}, len(t))
+		for i, e := range t {
+			blocks[i] = normalizeConfig(e).(map[string]interface{})
+		}
+		return blocks
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		blocks := make([]map[string]interface{}, len(t))
+		allBlocks := len(t) > 0
+		for i, e := range t {
+			list[i] = normalizeConfig(e)
+			if m, ok := list[i].(map[string]interface{}); ok {
+				blocks[i] = m
+			} else {
+				allBlocks = false
+			}
+		}
+		if allBlocks {
+			return blocks
+		}
+		return list
+	case float64:
+		if t == math.Trunc(t) && math.Abs(t) < math.MaxInt32 {
+			return int(t)
+		}
+	}
+	return v
+}
+
+// a whole number attribute, e.g. a rule priority, which the legacy loader leaves as a string
+// when it is given as one
+func intValue(v interface{}) (int, bool) {
+	switch t := v.(type) {
+	case int:
+		return t, true
+	case float64:
+		return int(t), true
+	case string:
+		n, err := strconv.Atoi(t)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// build the network graph from already resolved resource instances
+func instancesToGraph(instances []*resourceInstance) (*graph, error) {
+	thisGraph := newGraph()
+	g := thisGraph.SecurityGroups.Paths
+
+	for _, inst := range instances {
+		if inst.Region != "" {
+			thisGraph.Regions[inst.Resource] = inst.Region
+		}
+	}
+	for _, inst := range sortInstances(instances) {
+		cfg := normalizeConfig(inst.Config).(map[string]interface{})
+		c := &terraform.ResourceConfig{Raw: cfg, Config: cfg}
+		info := newInstanceInfo(inst.Info, 0)
+		// references are already qualified, so evaluate as if in the root module
+		info.II = &terraform.InstanceInfo{Id: info.ID, ModulePath: []string{"root"}, Type: inst.Info.Type}
+		if err := evalResource(info, c, g, thisGraph); err != nil {
+			return nil, &stageError{Stage: stageGraphBuild, Err: fmt.Errorf("%s: %s", info.ID, err)}
+		}
+	}
+	if err := finalizeGraph(g, thisGraph); err != nil {
+		return nil, &stageError{Stage: stageGraphBuild, Err: err}
+	}
+	return thisGraph, nil
+}
+
+func cytoscapeJSON(thisGraph *graph) (string, error) {
+	byteArray, err := json.Marshal(*thisGraph.CytoscapeData)
+	if err != nil {
+		return "", &stageError{Stage: stageGraphBuild, Err: err}
+	}
+	return string(byteArray), nil
+}
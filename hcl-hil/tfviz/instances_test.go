@@ -0,0 +1,72 @@
+package tfviz
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestSortInstances(t *testing.T) {
+	// an instance: its address in the root module or in module.net, then the addresses it
+	// depends on
+	inst := func(address string, dependsOn ...string) *resourceInstance {
+		path := []string{"root"}
+		if strings.HasPrefix(address, "module.net.") {
+			path = append(path, "net")
+			address = strings.TrimPrefix(address, "module.net.")
+		}
+		resource := address
+		if i := strings.Index(address, "["); i >= 0 {
+			resource = address[:i]
+		}
+		ii := &terraform.InstanceInfo{Id: address, ModulePath: path}
+		return &resourceInstance{Info: ii, Resource: modulePath(path, resource), DependsOn: dependsOn}
+	}
+
+	tests := []struct {
+		name      string
+		instances []*resourceInstance
+		want      string
+	}{
+		{
+			"no dependencies",
+			[]*resourceInstance{inst("aws_vpc.b"), inst("aws_vpc.a"), inst("aws_subnet.a")},
+			"aws_subnet.a, aws_vpc.a, aws_vpc.b",
+		},
+		{
+			"chain",
+			[]*resourceInstance{inst("aws_instance.a", "aws_subnet.b"), inst("aws_subnet.b", "aws_vpc.c"), inst("aws_vpc.c")},
+			"aws_vpc.c, aws_subnet.b, aws_instance.a",
+		},
+		{
+			"dependency on a resource with several instances",
+			[]*resourceInstance{inst("aws_instance.a", "aws_subnet.z"), inst("aws_subnet.z[1]"), inst("aws_subnet.z[0]")},
+			"aws_subnet.z[0], aws_subnet.z[1], aws_instance.a",
+		},
+		{
+			"dependency on a module",
+			[]*resourceInstance{inst("aws_instance.a", "module.net"), inst("module.net.aws_subnet.s", "module.net.aws_vpc.v"), inst("module.net.aws_vpc.v")},
+			"module.net.aws_vpc.v, module.net.aws_subnet.s, aws_instance.a",
+		},
+		{
+			"cycle",
+			[]*resourceInstance{inst("aws_security_group.b", "aws_security_group.a"), inst("aws_security_group.a", "aws_security_group.b"), inst("aws_security_group.c", "aws_security_group.b")},
+			"aws_security_group.a, aws_security_group.b, aws_security_group.c",
+		},
+		{
+			"dependency on itself or on nothing drawn",
+			[]*resourceInstance{inst("aws_vpc.b", "aws_vpc.b", "var.cidr"), inst("aws_vpc.a")},
+			"aws_vpc.a, aws_vpc.b",
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, inst := range sortInstances(tt.instances) {
+			got = append(got, inst.Info.HumanId())
+		}
+		if s := strings.Join(got, ", "); s != tt.want {
+			t.Errorf("%s: sortInstances = %q, want %q", tt.name, s, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package tfviz
+
+import (
+	"strconv"
+
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// attachInterface draws a network interface attached to an instance as a node of its own, in
+// its own subnet and with the reachability of its own security groups, and an edge from the
+// instance to it labelled with its device, e.g. eth1.  The primary interface (device index 0)
+// of an instance is the instance node itself.
+func attachInterface(instance string, netID string, device int, g *dag.Graph, thisGraph *graph) error {
+	if !thisGraph.Topology.Has(instance) {
+		return nil // an instance that isn't drawn
+	}
+	if _, ok := thisGraph.Attachments[netID]; ok {
+		return nil // attached both inline and with an aws_network_interface_attachment
+	}
+	subnet := thisGraph.Topology.Parent(netID)
+	if !thisGraph.Topology.Has(netID) {
+		return nil // an interface that wasn't evaluated, or without a subnet
+	}
+	thisGraph.Attachments[netID] = instance
+
+	info := &cytoInstanceInfo{
+		ID: netID,
+		// netID is already qualified with its module path
+		II: &terraform.InstanceInfo{Id: netID, ModulePath: []string{"root"}, Type: "aws_network_interface"},
+	}
+	if err := thisGraph.addNode(info, &terraform.ResourceConfig{}, subnet, 0); err != nil {
+		return err
+	}
+	thisGraph.Topology.Attach(netID, instance)
+	for _, sg := range thisGraph.Topology.InterfaceGroups(netID) {
+		if err := connectBySG(info, sg, g, thisGraph); err != nil {
+			return err
+		}
+	}
+	if err := connectByCidr(info, subnet, g, thisGraph); err != nil {
+		return err
+	}
+	thisGraph.Topology.AddMember(subnet, netID)
+	thisGraph.addLabelledEdge(instance, netID, "eth"+strconv.Itoa(device))
+	return nil
+}
+
+// evaluate the interfaces an aws_network_interface attachment block or an
+// aws_network_interface_attachment (instanceKey "instance_id") attach
+func evalAttachment(ii *terraform.InstanceInfo, netID string, m map[string]interface{}, instanceKey string, g *dag.Graph, thisGraph *graph) error {
+	instance, ok1 := m[instanceKey].(string)
+	device, ok2 := portNumber(m["device_index"])
+	if !ok1 || !ok2 {
+		return nil
+	}
+	return attachInterface(modulePath(ii.ModulePath, strip(instance)), netID, device, g, thisGraph)
+}
@@ -0,0 +1,165 @@
+package tfviz
+
+import (
+	"math"
+	"sort"
+)
+
+// box is where a node is drawn, relative to the box of its parent
+type box struct {
+	X, Y, W, H int
+}
+
+const (
+	layoutIcon    = 78  // size of the leaves, with their label below them
+	layoutGapX    = 60  // between the leaves, leaving room for their labels
+	layoutGapY    = 50  // between rows, leaving room for the labels of the row above
+	layoutPadding = 30  // inside compound nodes, left, right and bottom
+	layoutTitle   = 40  // inside compound nodes, above their children, for their label
+	layoutMinW    = 160 // of an empty compound node
+)
+
+// a deterministic layout of a diagram: the nodes placed in each compound node go in rows, with as
+// many columns as rows, sorted by id whatever order the resources were evaluated in
+func layoutDiagram(d *diagram) map[string]box {
+	boxes := map[string]box{}
+	layoutChildren(d, "", layoutPadding, layoutPadding, boxes)
+	return boxes
+}
+
+// lay out the children of parent starting at left, top, returning the size they take
+func layoutChildren(d *diagram, parent string, left int, top int, boxes map[string]box) (int, int) {
+	children := append([]string{}, d.Children[parent]...)
+	sort.Slice(children, func(i, j int) bool {
+		if ci, cj := d.isCompound(children[i]), d.isCompound(children[j]); ci != cj {
+			return cj // the leaves, e.g. gateways, above the compound nodes
+		}
+		return children[i] < children[j]
+	})
+	for _, id := range children {
+		if !d.isCompound(id) {
+			boxes[id] = box{W: layoutIcon, H: layoutIcon}
+			continue
+		}
+		w, h := layoutChildren(d, id, layoutPadding, layoutTitle, boxes)
+		if w < layoutMinW {
+			w = layoutMinW
+		}
+		boxes[id] = box{W: w + layoutPadding, H: h + layoutPadding}
+	}
+	columns := int(math.Ceil(math.Sqrt(float64(len(children)))))
+	x, y, rowH, width := left, top, 0, left
+	for i, id := range children {
+		if i > 0 && i%columns == 0 {
+			x, y, rowH = left, y+rowH+layoutGapY, 0
+		}
+		b := boxes[id]
+		b.X, b.Y = x, y
+		boxes[id] = b
+		x += b.W + layoutGapX
+		if b.H > rowH {
+			rowH = b.H
+		}
+		if x-layoutGapX > width {
+			width = x - layoutGapX
+		}
+	}
+	if len(children) == 0 {
+		return left, top
+	}
+	return width, y + rowH
+}
+
+type point struct {
+	X, Y int
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// edgeRouter routes the edges of a laid out diagram around its leaves
+type edgeRouter struct {
+	leaves []box       // where the leaves are, absolute
+	lanes  map[int]int // detour -> edges routed through it so far
+}
+
+func newEdgeRouter(leaves []box) *edgeRouter {
+	return &edgeRouter{leaves: leaves, lanes: map[int]int{}}
+}
+
+// the lane of a detour next to where, spreading the edges going through it
+func (r *edgeRouter) lane(where int) int {
+	n := r.lanes[where]
+	r.lanes[where]++
+	return where + 25 + 6*(n%4)
+}
+
+// whether the horizontal or vertical segment from a to b crosses a leaf other than the ends
+func (r *edgeRouter) crosses(a point, b point, ends ...box) bool {
+	x1, x2, y1, y2 := a.X, b.X, a.Y, b.Y
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+	for _, leaf := range r.leaves {
+		if leaf == ends[0] || leaf == ends[1] {
+			continue
+		}
+		if x1 < leaf.X+leaf.W && x2 > leaf.X && y1 < leaf.Y+leaf.H && y2 > leaf.Y {
+			return true
+		}
+	}
+	return false
+}
+
+// an orthogonal route from the box of source to the box of target, leaving and entering at the
+// middle of the sides facing each other.  When that crosses a leaf, the route goes around through
+// the gap below the rows of both, or right of their columns.  offset moves the route aside so that
+// the edges of both directions don't overlap.
+func (r *edgeRouter) route(s box, t box, offset int) []point {
+	sx, sy := s.X+s.W/2, s.Y+s.H/2
+	tx, ty := t.X+t.W/2, t.Y+t.H/2
+	var route []point
+	horizontal := abs(tx-sx) >= abs(ty-sy)
+	if horizontal {
+		startX, endX := s.X+s.W, t.X
+		if tx < sx {
+			startX, endX = s.X, t.X+t.W
+		}
+		midX := (startX + endX) / 2
+		route = []point{{startX, sy + offset}, {midX, sy + offset}, {midX, ty + offset}, {endX, ty + offset}}
+	} else {
+		startY, endY := s.Y+s.H, t.Y
+		if ty < sy {
+			startY, endY = s.Y, t.Y+t.H
+		}
+		midY := (startY + endY) / 2
+		route = []point{{sx + offset, startY}, {sx + offset, midY}, {tx + offset, midY}, {tx + offset, endY}}
+	}
+	for i := 0; i+1 < len(route); i++ {
+		if !r.crosses(route[i], route[i+1], s, t) {
+			continue
+		}
+		if horizontal {
+			bottom := s.Y + s.H
+			if t.Y+t.H > bottom {
+				bottom = t.Y + t.H
+			}
+			laneY := r.lane(bottom)
+			return []point{{sx + offset, s.Y + s.H}, {sx + offset, laneY}, {tx + offset, laneY}, {tx + offset, t.Y + t.H}}
+		}
+		right := s.X + s.W
+		if t.X+t.W > right {
+			right = t.X + t.W
+		}
+		laneX := r.lane(right)
+		return []point{{s.X + s.W, sy + offset}, {laneX, sy + offset}, {laneX, ty + offset}, {t.X + t.W, ty + offset}}
+	}
+	return route
+}
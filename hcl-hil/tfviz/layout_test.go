@@ -0,0 +1,85 @@
+package tfviz
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// a diagram of nodes given as "id" or "id in parent", their type being the first part of their
+// id, e.g. aws_vpc for aws_vpc.main
+func newTestDiagram(nodes ...string) *diagram {
+	d := &diagram{Children: map[string][]string{}, byID: map[string]cytoscapeNodeBody{}}
+	for _, n := range nodes {
+		parts := strings.SplitN(n, " in ", 2)
+		id, parent := parts[0], ""
+		if len(parts) == 2 {
+			parent = parts[1]
+		}
+		d.byID[id] = cytoscapeNodeBody{ID: id, NodeType: strings.SplitN(id, ".", 2)[0]}
+		d.Children[parent] = append(d.Children[parent], id)
+	}
+	return d
+}
+
+func TestLayoutDiagram(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []string
+		want  map[string]box
+	}{
+		{
+			"leaves in rows as long as the columns, sorted by id",
+			[]string{"aws_internet_gateway.gw", "aws_instance.b", "aws_instance.a"},
+			map[string]box{
+				"aws_instance.a":          {30, 30, 78, 78},
+				"aws_instance.b":          {168, 30, 78, 78},
+				"aws_internet_gateway.gw": {30, 158, 78, 78},
+			},
+		},
+		{
+			"empty compound node",
+			[]string{"aws_vpc.main"},
+			map[string]box{
+				"aws_vpc.main": {30, 30, 190, 70},
+			},
+		},
+		{
+			"leaves before compound nodes, children relative to their parent",
+			[]string{"aws_vpc.main", "aws_subnet.a in aws_vpc.main", "aws_instance.web in aws_subnet.a", "aws_internet_gateway.gw"},
+			map[string]box{
+				"aws_internet_gateway.gw": {30, 30, 78, 78},
+				"aws_vpc.main":            {168, 30, 250, 218},
+				"aws_subnet.a":            {30, 40, 190, 148},
+				"aws_instance.web":        {30, 40, 78, 78},
+			},
+		},
+		{
+			"compound nodes wider than the minimum",
+			[]string{"aws_subnet.a", "aws_instance.x in aws_subnet.a", "aws_instance.y in aws_subnet.a"},
+			map[string]box{
+				"aws_subnet.a":   {30, 30, 276, 148},
+				"aws_instance.x": {30, 40, 78, 78},
+				"aws_instance.y": {168, 40, 78, 78},
+			},
+		},
+		{
+			"nothing to draw",
+			nil,
+			map[string]box{},
+		},
+	}
+	for _, tt := range tests {
+		got := layoutDiagram(newTestDiagram(tt.nodes...))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: layoutDiagram = %v, want %v", tt.name, got, tt.want)
+		}
+		reversed := make([]string, len(tt.nodes))
+		for i, n := range tt.nodes {
+			reversed[len(tt.nodes)-1-i] = n
+		}
+		if again := layoutDiagram(newTestDiagram(reversed...)); !reflect.DeepEqual(again, got) {
+			t.Errorf("%s: layoutDiagram depends on the order of the nodes: %v, then %v", tt.name, got, again)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package tfviz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// listener is an aws_lb_listener and the target groups it forwards to, by default or through
+// aws_lb_listener_rule resources
+type listener struct {
+	LoadBalancer string
+	Port         int
+	Protocol     string
+	TargetGroups []string
+}
+
+// targetGroup is the port and protocol traffic is sent to the targets of an aws_lb_target_group on
+type targetGroup struct {
+	Port     int
+	Protocol string
+}
+
+// lbTarget is a target registered with a target group, with the port it overrides the target
+// group's with, if any
+type lbTarget struct {
+	ID   string
+	Port int
+}
+
+// lbState is what load balancers forward traffic to
+type lbState struct {
+	Listeners          map[string]*listener   // aws_lb_listener -> its load balancer and target groups
+	TargetGroups       map[string]targetGroup // aws_lb_target_group -> port and protocol of its targets
+	TargetGroupMembers map[string][]lbTarget  // aws_lb_target_group -> registered targets
+}
+
+func newLbState() lbState {
+	return lbState{
+		Listeners:          make(map[string]*listener),
+		TargetGroups:       make(map[string]targetGroup),
+		TargetGroupMembers: make(map[string][]lbTarget),
+	}
+}
+
+// the ports traffic of a load balancer or target group protocol is sent to
+func lbPorts(protocol string, port int) portSet {
+	if port == 0 {
+		return nil
+	}
+	switch strings.ToUpper(protocol) {
+	case "UDP":
+		return portSet{{Protocol: "udp", From: port, To: port}}
+	case "TCP_UDP":
+		return portSet{{Protocol: "tcp", From: port, To: port}, {Protocol: "udp", From: port, To: port}}
+	case "GENEVE":
+		return portSet{{Protocol: "udp", From: 6081, To: 6081}}
+	}
+	// HTTP, HTTPS, TCP and TLS
+	return portSet{{Protocol: "tcp", From: port, To: port}}
+}
+
+// the target groups of the forward actions of a listener or listener rule
+func forwardTargetGroups(ii *terraform.InstanceInfo, actions interface{}) []string {
+	blocks, _ := actions.([]map[string]interface{})
+	var tgs []string
+	for _, action := range blocks {
+		if t, ok := action["type"].(string); ok && t != "forward" {
+			continue
+		}
+		if tg, ok := action["target_group_arn"].(string); ok && tg != "" {
+			tgs = append(tgs, stripAttribute(ii, tg, "arn"))
+		}
+		// weighted forwarding: forward { target_group { arn = ... } }
+		forward, _ := action["forward"].([]map[string]interface{})
+		for _, f := range forward {
+			groups, _ := f["target_group"].([]map[string]interface{})
+			for _, group := range groups {
+				if tg, ok := group["arn"].(string); ok && tg != "" {
+					tgs = append(tgs, stripAttribute(ii, tg, "arn"))
+				}
+			}
+		}
+	}
+	return tgs
+}
+
+// add the nodes of application and network load balancers and their listeners, and record the
+// target groups and their targets.  The traffic from listeners to targets is only drawn by
+// evalLoadBalancers, once every target and security group is known.
+func evalLoadBalancerResource(info *cytoInstanceInfo, c *terraform.ResourceConfig, g *dag.Graph, thisGraph *graph) error {
+	ii := info.II
+
+	switch ii.Type {
+	case "aws_lb", "aws_alb":
+		var subnets, sgs []string
+		if p, ok := c.Get("subnets"); ok {
+			for _, sub := range p.([]interface{}) {
+				subnets = append(subnets, modulePath(ii.ModulePath, strip(sub.(string))))
+			}
+		}
+		if p, ok := c.Get("subnet_mapping"); ok {
+			for _, m := range p.([]map[string]interface{}) {
+				if sub, ok := m["subnet_id"].(string); ok {
+					subnets = append(subnets, modulePath(ii.ModulePath, strip(sub)))
+				}
+			}
+		}
+		if p, ok := c.Get("security_groups"); ok {
+			for _, sg := range p.([]interface{}) {
+				sgs = append(sgs, modulePath(ii.ModulePath, strip(sg.(string))))
+			}
+		}
+		_, err := cloneBySubnet(info, c, subnets, sgs, g, thisGraph)
+		return err
+
+	case "aws_lb_listener", "aws_alb_listener":
+		lb, ok := c.Get("load_balancer_arn")
+		if !ok {
+			return nil
+		}
+		l := &listener{LoadBalancer: stripAttribute(ii, lb.(string), "arn")}
+		if p, ok := c.Get("port"); ok {
+			l.Port, _ = portNumber(p)
+		}
+		if p, ok := c.Get("protocol"); ok {
+			l.Protocol, _ = p.(string)
+		}
+		if p, ok := c.Get("default_action"); ok {
+			l.TargetGroups = forwardTargetGroups(ii, p)
+		}
+		thisGraph.LoadBalancing.Listeners[info.ID] = l
+
+		clones := thisGraph.Clones[l.LoadBalancer]
+		if len(clones) == 0 {
+			return nil // a load balancer that isn't drawn
+		}
+		// next to the load balancer, in its vpc
+		vpc := thisGraph.Topology.Parent(thisGraph.Topology.Parent(clones[0]))
+		if err := thisGraph.addNode(info, c, vpc, 0); err != nil {
+			return err
+		}
+		label := strings.TrimPrefix(fmt.Sprintf("%s:%d", strings.ToUpper(l.Protocol), l.Port), ":")
+		for _, clone := range clones {
+			thisGraph.addLabelledEdge(clone, info.ID, label)
+		}
+
+	case "aws_lb_listener_rule", "aws_alb_listener_rule":
+		p, ok1 := c.Get("listener_arn")
+		actions, ok2 := c.Get("action")
+		if ok1 && ok2 {
+			if l, ok := thisGraph.LoadBalancing.Listeners[stripAttribute(ii, p.(string), "arn")]; ok {
+				l.TargetGroups = append(l.TargetGroups, forwardTargetGroups(ii, actions)...)
+			}
+		}
+
+	case "aws_lb_target_group", "aws_alb_target_group":
+		tg := targetGroup{Protocol: "TCP"}
+		if p, ok := c.Get("port"); ok {
+			tg.Port, _ = portNumber(p)
+		}
+		if p, ok := c.Get("protocol"); ok {
+			tg.Protocol, _ = p.(string)
+		}
+		thisGraph.LoadBalancing.TargetGroups[info.ID] = tg
+
+	case "aws_lb_target_group_attachment", "aws_alb_target_group_attachment":
+		tg, ok1 := c.Get("target_group_arn")
+		id, ok2 := c.Get("target_id")
+		if !ok1 || !ok2 || !isInterpolated(id.(string)) {
+			return nil // ip and lambda targets aren't drawn
+		}
+		target := lbTarget{ID: modulePath(ii.ModulePath, strip(id.(string)))}
+		if p, ok := c.Get("port"); ok {
+			target.Port, _ = portNumber(p)
+		}
+		thisGraph.addLbTarget(stripAttribute(ii, tg.(string), "arn"), target)
+	}
+	return nil
+}
+
+func (g *graph) addLbTarget(tg string, target lbTarget) {
+	g.LoadBalancing.TargetGroupMembers[tg] = append(g.LoadBalancing.TargetGroupMembers[tg], target)
+}
+
+// once every resource is evaluated, draw the traffic from each listener to the targets of its
+// target groups.  The back side is subject to the security groups like any other traffic: only
+// the ports they allow from the load balancer to a target are drawn, the rest are listed as
+// blocked, and traffic they block altogether is reported as a warning instead of drawn.
+func evalLoadBalancers(thisGraph *graph) error {
+	var ids []string
+	for id := range thisGraph.LoadBalancing.Listeners {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if !thisGraph.Topology.Has(id) {
+			continue // a listener that isn't drawn
+		}
+		l := thisGraph.LoadBalancing.Listeners[id]
+		seen := map[string]bool{}
+		for _, tgID := range l.TargetGroups {
+			if seen[tgID] {
+				continue
+			}
+			seen[tgID] = true
+			tg := thisGraph.LoadBalancing.TargetGroups[tgID]
+			for _, target := range thisGraph.LoadBalancing.TargetGroupMembers[tgID] {
+				if !thisGraph.Topology.Has(target.ID) {
+					continue
+				}
+				port := tg.Port
+				if target.Port != 0 {
+					port = target.Port
+				}
+				thisGraph.addListenerEdge(id, l.LoadBalancer, target.ID, lbPorts(tg.Protocol, port))
+			}
+		}
+	}
+	return nil
+}
+
+// draw the traffic from a listener to a target on the ports the security groups allow
+func (g *graph) addListenerEdge(listener string, lb string, target string, ports portSet) {
+	if ports == nil {
+		// e.g. a lambda target group, without a port
+		g.addLabelledEdge(listener, target, "")
+		return
+	}
+	var allowed portSet
+	for _, clone := range g.Clones[lb] {
+		key := edgeKey(clone, target)
+		if _, ok := g.Edges.Index[key]; !ok {
+			continue
+		}
+		if p := g.Edges.Ports[key]; p != nil {
+			allowed = allowed.merge(p)
+		} else {
+			// the security group rules' ports aren't known
+			allowed = allowed.merge(ports)
+		}
+	}
+	allowed = ports.intersect(allowed)
+	blocked := ports.subtract(allowed)
+
+	if allowed == nil {
+		g.warn("security groups block the traffic from %s to %s", listener, target)
+		return
+	}
+	g.addEdge(listener, target, allowed)
+	if blocked != nil {
+		edge := &(*g.CytoscapeData)[g.Edges.Index[edgeKey(listener, target)]].Data
+		edge.Blocked = blocked.strings()
+	}
+}
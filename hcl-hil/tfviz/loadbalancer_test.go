@@ -0,0 +1,40 @@
+package tfviz
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddListenerEdge(t *testing.T) {
+	tests := []struct {
+		name     string
+		sg       portSet // allowed from the load balancer to the target, nil for no edge
+		ports    portSet
+		want     string // ports of the listener's edge, "-" for none
+		blocked  string
+		warnings int
+	}{
+		{"allowed", portSet{{"tcp", 0, 65535}}, lbPorts("HTTP", 80), "tcp/80", "", 0},
+		{"partly allowed", portSet{{"tcp", 80, 80}}, lbPorts("TCP_UDP", 80), "tcp/80", "udp/80", 0},
+		{"blocked", portSet{{"tcp", 443, 443}}, lbPorts("HTTP", 80), "-", "", 1},
+		{"no security group edge", nil, lbPorts("HTTP", 80), "-", "", 1},
+		{"no port", nil, nil, "", "", 0},
+	}
+	for _, tt := range tests {
+		g := newGraph()
+		g.Clones["aws_lb.x"] = []string{"aws_lb.x#0"}
+		if tt.sg != nil {
+			g.addEdge("aws_lb.x#0", "aws_instance.a", tt.sg)
+		}
+		g.addListenerEdge("aws_lb_listener.l", "aws_lb.x", "aws_instance.a", tt.ports)
+
+		got, blocked := "-", ""
+		if i, ok := g.Edges.Index[edgeKey("aws_lb_listener.l", "aws_instance.a")]; ok {
+			edge := (*g.CytoscapeData)[i].Data
+			got, blocked = strings.Join(edge.Ports, ", "), strings.Join(edge.Blocked, ", ")
+		}
+		if got != tt.want || blocked != tt.blocked || len(g.Warnings) != tt.warnings {
+			t.Errorf("%s: ports %q, blocked %q, %d warnings, want %q, %q, %d", tt.name, got, blocked, len(g.Warnings), tt.want, tt.blocked, tt.warnings)
+		}
+	}
+}
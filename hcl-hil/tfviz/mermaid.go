@@ -0,0 +1,186 @@
+package tfviz
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// count and for_each groups with more instances than this are drawn as one node in each
+// subnet, keeping the flowchart within what mermaid lays out legibly
+var mermaidMaxCount = 8
+
+// an address with an instance key, e.g. aws_instance.web[2] or aws_subnet.private["a"]
+var instanceKey = regexp.MustCompile(`^(.+)\[[^\[\]]*\]$`)
+
+// mermaid class of the compound nodes, by node type, and the class definitions matching
+// web/style.json
+var mermaidClasses = map[string]string{
+	"region":                    "region",
+	"aws_vpc":                   "vpc",
+	"google_compute_network":    "vpc",
+	"azurerm_virtual_network":   "vpc",
+	"az":                        "az",
+	"aws_subnet":                "subnet",
+	"google_compute_subnetwork": "subnet",
+	"azurerm_subnet":            "subnet",
+}
+
+var mermaidClassDefs = map[string]string{
+	"region": "fill:#f0f0fc,stroke:#000000",
+	"vpc":    "fill:none,stroke:#6b788c,stroke-dasharray:2",
+	"az":     "fill:none,stroke:#f4ad42,stroke-dasharray:5",
+	"subnet": "fill:none,stroke:#ff5959,stroke-dasharray:5",
+}
+
+// a mermaid string, which takes entities rather than escapes
+func mermaidQuote(s string) string {
+	return `"` + strings.Replace(s, `"`, "#quot;", -1) + `"`
+}
+
+type mermaidWriter struct {
+	d         *diagram
+	b         bytes.Buffer
+	groupSize map[string]int      // count group -> its instances
+	ids       map[string]string   // node -> mermaid id of what it is drawn as
+	groupIDs  map[string]string   // parent and count group -> mermaid id of the group
+	classes   map[string][]string // class -> mermaid ids of its nodes
+	next      int
+}
+
+// the diagram as a mermaid flowchart, for markdown that renders mermaid, like pull requests.
+// Compound nodes like vpcs and subnets become subgraphs.
+func mermaidFlowchart(thisGraph *graph) (string, error) {
+	w := &mermaidWriter{
+		d:         newDiagram(thisGraph),
+		groupSize: map[string]int{},
+		ids:       map[string]string{},
+		groupIDs:  map[string]string{},
+		classes:   map[string][]string{},
+	}
+	for _, n := range w.d.Nodes {
+		if m := instanceKey.FindStringSubmatch(n.ID); m != nil && !w.d.isCompound(n.ID) {
+			w.groupSize[m[1]]++
+		}
+	}
+	w.b.WriteString("flowchart LR\n")
+	w.writeChildren("", "  ")
+	w.writeEdges()
+	var classes []string
+	for class := range w.classes {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		fmt.Fprintf(&w.b, "  classDef %s %s\n", class, mermaidClassDefs[class])
+		fmt.Fprintf(&w.b, "  class %s %s\n", strings.Join(w.classes[class], ","), class)
+	}
+	return w.b.String(), nil
+}
+
+// the count group a node is collapsed into, if any
+func (w *mermaidWriter) collapsedGroup(id string) string {
+	m := instanceKey.FindStringSubmatch(id)
+	if m == nil || w.d.isCompound(id) || w.groupSize[m[1]] <= mermaidMaxCount {
+		return ""
+	}
+	return m[1]
+}
+
+func (w *mermaidWriter) newID() string {
+	w.next++
+	return fmt.Sprintf("n%d", w.next-1)
+}
+
+func (w *mermaidWriter) writeChildren(parent string, indent string) {
+	inParent := map[string]int{}
+	for _, id := range w.d.Children[parent] {
+		if group := w.collapsedGroup(id); group != "" {
+			inParent[group]++
+		}
+	}
+	for _, id := range w.d.Children[parent] {
+		if group := w.collapsedGroup(id); group != "" {
+			key := parent + " " + group
+			mid, ok := w.groupIDs[key]
+			if !ok {
+				mid = w.newID()
+				w.groupIDs[key] = mid
+				label := fmt.Sprintf("%s[*] (%d of %d)", group, inParent[group], w.groupSize[group])
+				fmt.Fprintf(&w.b, "%s%s[%s]\n", indent, mid, mermaidQuote(label))
+			}
+			w.ids[id] = mid
+			continue
+		}
+		mid := w.newID()
+		w.ids[id] = mid
+		if !w.d.isCompound(id) {
+			if w.d.byID[id].NodeType == "cloud" {
+				fmt.Fprintf(&w.b, "%s%s((%s))\n", indent, mid, mermaidQuote(w.d.label(id)))
+			} else {
+				fmt.Fprintf(&w.b, "%s%s[%s]\n", indent, mid, mermaidQuote(w.d.label(id)))
+			}
+			continue
+		}
+		fmt.Fprintf(&w.b, "%ssubgraph %s[%s]\n", indent, mid, mermaidQuote(w.d.label(id)))
+		if class, ok := mermaidClasses[w.d.byID[id].NodeType]; ok {
+			w.classes[class] = append(w.classes[class], mid)
+		}
+		w.writeChildren(id, indent+"  ")
+		fmt.Fprintf(&w.b, "%send\n", indent)
+	}
+}
+
+// the edges between what the nodes are drawn as, merging the edges of collapsed groups
+func (w *mermaidWriter) writeEdges() {
+	type link struct {
+		source, target string
+		dotted         bool
+		labels         []string
+		blocked        bool
+	}
+	var links []*link
+	byKey := map[string]*link{}
+	for _, e := range w.d.Edges {
+		source, ok := w.ids[e.Source]
+		target, ok2 := w.ids[e.Target]
+		if !ok || !ok2 {
+			continue
+		}
+		dotted := len(e.Ports) == 0 // an edge that carries no traffic, e.g. a route
+		key := fmt.Sprintf("%s %s %t", source, target, dotted)
+		l, ok := byKey[key]
+		if !ok {
+			l = &link{source: source, target: target, dotted: dotted}
+			byKey[key] = l
+			links = append(links, l)
+		}
+		if e.Label != "" {
+			for _, label := range strings.Split(e.Label, ", ") {
+				if !containsString(l.labels, label) {
+					l.labels = append(l.labels, label)
+				}
+			}
+		}
+		l.blocked = l.blocked || e.RepliesBlocked
+	}
+	var blocked []string
+	for i, l := range links {
+		arrow := "-->"
+		if l.dotted {
+			arrow = "-.->"
+		}
+		if len(l.labels) > 0 {
+			arrow += "|" + mermaidQuote(strings.Join(l.labels, ", ")) + "|"
+		}
+		fmt.Fprintf(&w.b, "  %s %s %s\n", l.source, arrow, l.target)
+		if l.blocked {
+			blocked = append(blocked, fmt.Sprint(i))
+		}
+	}
+	if len(blocked) > 0 {
+		fmt.Fprintf(&w.b, "  linkStyle %s stroke:#cc0000,stroke-dasharray:5\n", strings.Join(blocked, ","))
+	}
+}
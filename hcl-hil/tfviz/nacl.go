@@ -0,0 +1,237 @@
+package tfviz
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// ports of the replies to a connection, which stateless network acls have to allow as well
+var ephemeralPorts = portSet{
+	{Protocol: "tcp", From: 1024, To: 65535},
+	{Protocol: "udp", From: 1024, To: 65535},
+}
+
+// the ports replies to connections on ports come back on
+func replyPorts(ports portSet) portSet {
+	var replies portSet
+	for _, r := range ports.expand() {
+		for _, e := range ephemeralPorts {
+			if e.Protocol == r.Protocol {
+				replies = append(replies, e)
+			}
+		}
+	}
+	return portSet{}.merge(replies)
+}
+
+// naclRule is a single numbered entry of a network acl
+type naclRule struct {
+	Number int
+	Egress bool
+	Allow  bool
+	Cidr   string
+	Ports  portSet // nil when the protocol or ports aren't known
+}
+
+// naclState is the network acls of the subnets
+type naclState struct {
+	Rules      map[string][]naclRule // network acl -> rules, inline or from aws_network_acl_rule
+	SubnetNacl map[string]string     // subnet -> network acl
+}
+
+func newNaclState() naclState {
+	return naclState{
+		Rules:      make(map[string][]naclRule),
+		SubnetNacl: make(map[string]string),
+	}
+}
+
+// read a rule from an inline ingress/egress block (numberKey "rule_no", actionKey "action")
+// or an aws_network_acl_rule (numberKey "rule_number", actionKey "rule_action")
+func naclRuleOf(m map[string]interface{}, egress bool, numberKey string, actionKey string) (naclRule, bool) {
+	number, ok := portNumber(m[numberKey])
+	if !ok {
+		return naclRule{}, false
+	}
+	cidr, ok := m["cidr_block"].(string)
+	if !ok || isInterpolated(cidr) {
+		return naclRule{}, false
+	}
+	action, _ := m[actionKey].(string)
+	return naclRule{
+		Number: number,
+		Egress: egress,
+		Allow:  strings.ToLower(action) == "allow",
+		Cidr:   cidr,
+		Ports:  rulePorts(m),
+	}, true
+}
+
+func (g *graph) addNaclRule(nacl string, r naclRule) {
+	g.Nacls.Rules[nacl] = append(g.Nacls.Rules[nacl], r)
+}
+
+// add the rules and subnet associations of the network acl resources.  Whether traffic is
+// blocked is only decided by evalNetworkACLs, once every rule is known.
+func evalNaclResource(info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+	ii := info.II
+
+	switch ii.Type {
+	case "aws_network_acl", "aws_default_network_acl":
+		if subnets, ok := c.Get("subnet_ids"); ok {
+			for _, s := range subnets.([]interface{}) {
+				thisGraph.Nacls.SubnetNacl[modulePath(ii.ModulePath, strip(s.(string)))] = info.ID
+			}
+		}
+		for _, direction := range []string{"ingress", "egress"} {
+			if rules, ok := c.Get(direction); ok {
+				for _, m := range rules.([]map[string]interface{}) {
+					if r, ok := naclRuleOf(m, direction == "egress", "rule_no", "action"); ok {
+						thisGraph.addNaclRule(info.ID, r)
+					}
+				}
+			}
+		}
+		// an acl without rules still denies everything
+		if _, ok := thisGraph.Nacls.Rules[info.ID]; !ok {
+			thisGraph.Nacls.Rules[info.ID] = nil
+		}
+
+	case "aws_network_acl_rule":
+		if p, ok := c.Get("network_acl_id"); ok {
+			egress, _ := c.Config["egress"].(bool)
+			if r, ok := naclRuleOf(c.Config, egress, "rule_number", "rule_action"); ok {
+				thisGraph.addNaclRule(modulePath(ii.ModulePath, strip(p.(string))), r)
+			}
+		}
+
+	case "aws_network_acl_association":
+		subnet, ok1 := c.Get("subnet_id")
+		nacl, ok2 := c.Get("network_acl_id")
+		if ok1 && ok2 {
+			thisGraph.Nacls.SubnetNacl[modulePath(ii.ModulePath, strip(subnet.(string)))] = modulePath(ii.ModulePath, strip(nacl.(string)))
+		}
+	}
+	return nil
+}
+
+// the ports of ports the network acl of subnet lets through to (egress) or from (!egress)
+// every address of peer.  Rules are applied in rule number order, the first matching rule
+// deciding, and what no rule matches is denied.  A rule whose cidr block covers only part of
+// peer doesn't allow its ports, which are only allowed for some of the addresses, but denies
+// them, which are blocked for some.  Subnets without a known acl use the default one, which
+// allows all.
+func (g *graph) naclAllows(subnet string, egress bool, peer *net.IPNet, ports portSet) portSet {
+	nacl, ok := g.Nacls.SubnetNacl[subnet]
+	if !ok {
+		return ports
+	}
+	rules, ok := g.Nacls.Rules[nacl]
+	if !ok {
+		return ports // rules of an acl that wasn't evaluated
+	}
+	sorted := make([]naclRule, 0, len(rules))
+	for _, r := range rules {
+		if r.Egress == egress {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Number < sorted[j].Number
+	})
+
+	var allowed portSet
+	remaining := ports
+	for _, r := range sorted {
+		_, cidr, err := net.ParseCIDR(r.Cidr)
+		if err != nil || r.Ports == nil || !(cidr.Contains(peer.IP) || peer.Contains(cidr.IP)) {
+			continue
+		}
+		ones, _ := cidr.Mask.Size()
+		peerOnes, _ := peer.Mask.Size()
+		if partial := ones > peerOnes; partial && r.Allow {
+			continue
+		}
+		matched := remaining.intersect(r.Ports)
+		if r.Allow {
+			allowed = allowed.merge(matched)
+		}
+		remaining = remaining.subtract(matched)
+	}
+	return allowed
+}
+
+// the subnet and cidr block traffic to or from an end point of a drawn edge comes from
+func (g *graph) edgeEndPoint(id string, subnets map[string]string) (string, *net.IPNet, bool) {
+	if id == internetID {
+		_, any, _ := net.ParseCIDR("0.0.0.0/0")
+		return "", any, true
+	}
+	subnet, ok := subnets[id]
+	if !ok {
+		subnet = g.Topology.Parent(id) // e.g. a nat gateway
+	}
+	dest, _ := g.Topology.Cidr(subnet)
+	_, cidr, err := net.ParseCIDR(dest)
+	if err != nil {
+		return "", nil, false
+	}
+	return subnet, cidr, true
+}
+
+// once every resource is evaluated, check the traffic drawn between subnets against their
+// network acls.  Edges are trimmed to the ports the acls let through both ways, with the rest
+// listed as blocked, and removed when nothing gets through.  Since acls are stateless, edges
+// whose replies the acls block are marked as well.
+func evalNetworkACLs(thisGraph *graph) error {
+	if len(thisGraph.Nacls.SubnetNacl) == 0 {
+		return nil
+	}
+	subnets := map[string]string{}
+	for _, subnet := range thisGraph.Topology.SubnetIDs() {
+		for _, m := range thisGraph.Topology.SubnetMembers(subnet) {
+			subnets[m] = subnet
+		}
+	}
+
+	removed := map[int]bool{}
+	for i := range *thisGraph.CytoscapeData {
+		edge := &(*thisGraph.CytoscapeData)[i].Data
+		ports := thisGraph.Edges.Ports[edgeKey(edge.Source, edge.Target)]
+		if edge.NodeType != "edge" || ports == nil {
+			continue
+		}
+		srcSubnet, srcCidr, ok1 := thisGraph.edgeEndPoint(edge.Source, subnets)
+		dstSubnet, dstCidr, ok2 := thisGraph.edgeEndPoint(edge.Target, subnets)
+		if !ok1 || !ok2 || srcSubnet == dstSubnet {
+			continue // acls only filter traffic crossing a subnet boundary
+		}
+
+		allowed := thisGraph.naclAllows(srcSubnet, true, dstCidr, ports)
+		allowed = thisGraph.naclAllows(dstSubnet, false, srcCidr, allowed)
+		if len(allowed) == 0 {
+			thisGraph.warn("network acls block the traffic from %s to %s", edge.Source, edge.Target)
+			removed[i] = true
+			continue
+		}
+		if replies := replyPorts(allowed); replies != nil {
+			back := thisGraph.naclAllows(dstSubnet, true, srcCidr, replies)
+			back = thisGraph.naclAllows(srcSubnet, false, dstCidr, back)
+			edge.RepliesBlocked = replies.subtract(back) != nil
+		}
+		blocked := ports.subtract(allowed)
+		if blocked != nil {
+			edge.Ports = allowed.strings()
+			edge.Blocked = blocked.strings()
+			edge.Label = strings.Join(edge.Ports, ", ")
+		}
+		if edge.RepliesBlocked {
+			edge.Label += " (replies blocked)"
+		}
+	}
+	thisGraph.removeElements(removed)
+	return nil
+}
@@ -0,0 +1,47 @@
+package tfviz
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNaclAllows(t *testing.T) {
+	g := newGraph()
+	g.Nacls.SubnetNacl["aws_subnet.priv"] = "aws_network_acl.priv"
+	g.Nacls.Rules["aws_network_acl.priv"] = []naclRule{
+		{Number: 200, Allow: true, Cidr: "10.0.0.0/16", Ports: portSet{{"tcp", 0, 65535}}},
+		{Number: 100, Allow: false, Cidr: "10.0.1.0/24", Ports: portSet{{"tcp", 22, 22}}},
+		{Number: 300, Allow: true, Cidr: "192.168.1.0/24", Ports: portSet{{Protocol: "all"}}},
+		{Number: 100, Egress: true, Allow: true, Cidr: "0.0.0.0/0", Ports: portSet{{"tcp", 443, 443}}},
+	}
+	web := portSet{{"tcp", 22, 22}, {"tcp", 80, 80}}
+
+	tests := []struct {
+		name   string
+		subnet string
+		egress bool
+		peer   string
+		ports  portSet
+		want   string
+	}{
+		{"allowed", "aws_subnet.priv", false, "10.0.2.0/24", web, "tcp/22, tcp/80"},
+		{"denied by an earlier rule", "aws_subnet.priv", false, "10.0.1.0/24", web, "tcp/80"},
+		{"denied for part of the peer", "aws_subnet.priv", false, "10.0.0.0/16", web, "tcp/80"},
+		{"allowed for part of the peer", "aws_subnet.priv", false, "192.168.0.0/16", web, ""},
+		{"allowed for all of the peer", "aws_subnet.priv", false, "192.168.1.16/28", web, "tcp/22, tcp/80"},
+		{"no rule matches", "aws_subnet.priv", false, "172.16.0.0/12", web, ""},
+		{"egress", "aws_subnet.priv", true, "0.0.0.0/0", portSet{{"tcp", 443, 443}, {"udp", 53, 53}}, "tcp/443"},
+		{"default acl", "aws_subnet.pub", false, "0.0.0.0/0", web, "tcp/22, tcp/80"},
+	}
+	for _, tt := range tests {
+		_, peer, err := net.ParseCIDR(tt.peer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := strings.Join(g.naclAllows(tt.subnet, tt.egress, peer, tt.ports).strings(), ", ")
+		if got != tt.want {
+			t.Errorf("%s: naclAllows(%s, %v, %s) = %q, want %q", tt.name, tt.subnet, tt.egress, tt.peer, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package tfviz
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// transitGateway is whether the attachments of an aws_ec2_transit_gateway are associated with
+// and propagate to its default route table, unless they opt out
+type transitGateway struct {
+	DefaultAssociation bool
+	DefaultPropagation bool
+}
+
+// tgwAttachment is an aws_ec2_transit_gateway_vpc_attachment
+type tgwAttachment struct {
+	TransitGateway     string
+	Vpc                string
+	DefaultAssociation bool
+	DefaultPropagation bool
+}
+
+// peeringState is what joins vpcs: peering connections and transit gateways
+type peeringState struct {
+	Peerings        map[string][]string // vpc peering connection -> the vpcs it joins
+	TransitGateways map[string]transitGateway
+	TgwAttachments  map[string]tgwAttachment // transit gateway vpc attachment -> its transit gateway and vpc
+	TgwAssociations map[string]string        // transit gateway attachment -> route table it is associated with
+	TgwPropagations map[string][]string      // transit gateway route table -> attachments propagating to it
+}
+
+func newPeeringState() peeringState {
+	return peeringState{
+		Peerings:        make(map[string][]string),
+		TransitGateways: make(map[string]transitGateway),
+		TgwAttachments:  make(map[string]tgwAttachment),
+		TgwAssociations: make(map[string]string),
+		TgwPropagations: make(map[string][]string),
+	}
+}
+
+// the default route table of a transit gateway, named after the attribute referencing it
+func defaultTgwRouteTable(tgw string) string {
+	return tgw + ".association_default_route_table_id"
+}
+
+// the transit gateway route table a reference points at.  The default route table is the same
+// whether referenced for association or propagation.
+func tgwRouteTable(ii *terraform.InstanceInfo, ref string) string {
+	rt := modulePath(ii.ModulePath, strip(ref))
+	if strings.HasSuffix(rt, ".propagation_default_route_table_id") {
+		return defaultTgwRouteTable(strings.TrimSuffix(rt, ".propagation_default_route_table_id"))
+	}
+	return rt
+}
+
+// add the nodes of vpc peering connections and transit gateways, connected to the vpcs they
+// join, and record the transit gateway route tables.  Route tables sending traffic to them are
+// drawn by evalRouting like any other gateway, and the traffic between vpcs is only checked by
+// evalVpcPeering, once every route is known.
+func evalPeeringResource(info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+	ii := info.II
+
+	switch ii.Type {
+	case "aws_vpc_peering_connection":
+		var vpcs []string
+		for _, key := range []string{"vpc_id", "peer_vpc_id"} {
+			if p, ok := c.Get(key); ok && isInterpolated(p.(string)) {
+				vpcs = append(vpcs, modulePath(ii.ModulePath, strip(p.(string))))
+			}
+		}
+		if err := thisGraph.addNode(info, c, "", 0); err != nil {
+			return err
+		}
+		thisGraph.Routing.Gateways[info.ID] = ii.Type
+		thisGraph.Peering.Peerings[info.ID] = vpcs
+		for _, vpc := range vpcs {
+			if thisGraph.Topology.Has(vpc) {
+				thisGraph.addLabelledEdge(info.ID, vpc, "")
+			}
+		}
+
+	case "aws_ec2_transit_gateway":
+		tgw := transitGateway{DefaultAssociation: true, DefaultPropagation: true}
+		if p, ok := c.Get("default_route_table_association"); ok {
+			tgw.DefaultAssociation = p != "disable"
+		}
+		if p, ok := c.Get("default_route_table_propagation"); ok {
+			tgw.DefaultPropagation = p != "disable"
+		}
+		if err := thisGraph.addNode(info, c, "", 0); err != nil {
+			return err
+		}
+		thisGraph.Routing.Gateways[info.ID] = ii.Type
+		thisGraph.Peering.TransitGateways[info.ID] = tgw
+		thisGraph.addArnRegion(info, c)
+
+	case "aws_ec2_transit_gateway_vpc_attachment":
+		tgw, ok1 := c.Get("transit_gateway_id")
+		vpc, ok2 := c.Get("vpc_id")
+		if !ok1 || !ok2 {
+			return nil
+		}
+		att := tgwAttachment{
+			TransitGateway:     modulePath(ii.ModulePath, strip(tgw.(string))),
+			Vpc:                modulePath(ii.ModulePath, strip(vpc.(string))),
+			DefaultAssociation: true,
+			DefaultPropagation: true,
+		}
+		if p, ok := c.Get("transit_gateway_default_route_table_association"); ok {
+			att.DefaultAssociation, _ = p.(bool)
+		}
+		if p, ok := c.Get("transit_gateway_default_route_table_propagation"); ok {
+			att.DefaultPropagation, _ = p.(bool)
+		}
+		thisGraph.Peering.TgwAttachments[info.ID] = att
+		if thisGraph.Topology.Has(att.TransitGateway) && thisGraph.Topology.Has(att.Vpc) {
+			thisGraph.addLabelledEdge(att.TransitGateway, att.Vpc, "")
+		}
+
+	case "aws_ec2_transit_gateway_route":
+		rt, ok := c.Get("transit_gateway_route_table_id")
+		dest, ok2 := c.Get("destination_cidr_block")
+		if !ok || !ok2 {
+			return nil
+		}
+		r := route{Destination: strip(dest.(string)), Kind: "blackhole"}
+		if b, _ := c.Get("blackhole"); b != true {
+			att, ok := c.Get("transit_gateway_attachment_id")
+			if !ok {
+				return nil
+			}
+			r.Target = modulePath(ii.ModulePath, strip(att.(string)))
+			r.Kind = "transit_gateway_attachment_id"
+		}
+		thisGraph.addRoute(tgwRouteTable(ii, rt.(string)), r)
+
+	case "aws_ec2_transit_gateway_route_table_association":
+		att, ok1 := c.Get("transit_gateway_attachment_id")
+		rt, ok2 := c.Get("transit_gateway_route_table_id")
+		if ok1 && ok2 {
+			thisGraph.Peering.TgwAssociations[modulePath(ii.ModulePath, strip(att.(string)))] = tgwRouteTable(ii, rt.(string))
+		}
+
+	case "aws_ec2_transit_gateway_route_table_propagation":
+		att, ok1 := c.Get("transit_gateway_attachment_id")
+		rt, ok2 := c.Get("transit_gateway_route_table_id")
+		if ok1 && ok2 {
+			table := tgwRouteTable(ii, rt.(string))
+			thisGraph.Peering.TgwPropagations[table] = append(thisGraph.Peering.TgwPropagations[table], modulePath(ii.ModulePath, strip(att.(string))))
+		}
+	}
+	return nil
+}
+
+// the transit gateway route table an attachment is associated with, explicitly or by default
+func (g *graph) tgwAssociation(att string) (string, bool) {
+	if rt, ok := g.Peering.TgwAssociations[att]; ok {
+		return rt, true
+	}
+	a := g.Peering.TgwAttachments[att]
+	if a.DefaultAssociation && g.Peering.TransitGateways[a.TransitGateway].DefaultAssociation {
+		return defaultTgwRouteTable(a.TransitGateway), true
+	}
+	return "", false
+}
+
+// add the routes to the vpcs of the attachments propagating to each transit gateway route
+// table, explicitly or by default
+func (g *graph) propagateTgwRoutes() {
+	var atts []string
+	for att := range g.Peering.TgwAttachments {
+		atts = append(atts, att)
+	}
+	sort.Strings(atts)
+	propagations := map[string][]string{}
+	for rt, list := range g.Peering.TgwPropagations {
+		propagations[rt] = append(propagations[rt], list...)
+	}
+	for _, att := range atts {
+		a := g.Peering.TgwAttachments[att]
+		if a.DefaultPropagation && g.Peering.TransitGateways[a.TransitGateway].DefaultPropagation {
+			rt := defaultTgwRouteTable(a.TransitGateway)
+			propagations[rt] = append(propagations[rt], att)
+		}
+	}
+
+	var tables []string
+	for rt := range propagations {
+		tables = append(tables, rt)
+	}
+	sort.Strings(tables)
+	for _, rt := range tables {
+		for _, att := range propagations[rt] {
+			if cidr, ok := g.Routing.VpcCidrs[g.Peering.TgwAttachments[att].Vpc]; ok {
+				g.addRoute(rt, route{Destination: cidr, Target: att, Kind: "propagated"})
+			}
+		}
+	}
+}
+
+// the subnet and vpc a drawn node is placed in.  The subnet is empty for a node placed directly
+// in its vpc, like a listener, and both are empty for a node outside every vpc.
+func (g *graph) placement(id string) (string, string) {
+	var path []string
+	for cur := id; cur != "" && len(path) <= len(g.Topology.Nodes); cur = g.Topology.Parent(cur) {
+		path = append(path, cur)
+	}
+	if len(path) < 2 {
+		return "", ""
+	}
+	vpc := path[len(path)-1]
+	if _, ok := g.Routing.VpcCidrs[vpc]; !ok {
+		return "", ""
+	}
+	if len(path) < 3 {
+		return "", vpc
+	}
+	return path[len(path)-2], vpc
+}
+
+// whether the route table of the subnet (or the main one of the vpc) sends traffic for the
+// subnet (or vpc) on the other side to its vpc, through a peering connection or a transit gateway
+func (g *graph) routesBetween(fromSubnet string, fromVpc string, toSubnet string, toVpc string) bool {
+	table := g.Routing.MainRouteTables[fromVpc]
+	if fromSubnet != "" {
+		table = g.routeTable(fromSubnet)
+	}
+	dest, ok := g.Topology.Cidr(toSubnet)
+	if !ok {
+		dest = g.Routing.VpcCidrs[toVpc]
+	}
+	_, cidr, err := net.ParseCIDR(dest)
+	if err != nil {
+		return false
+	}
+	r, ok := g.longestRoute(table, cidr)
+	if !ok {
+		return false
+	}
+	if vpcs, ok := g.Peering.Peerings[r.Target]; ok {
+		return len(vpcs) == 2 && (vpcs[0] == fromVpc && vpcs[1] == toVpc || vpcs[0] == toVpc && vpcs[1] == fromVpc)
+	}
+	if _, ok := g.Peering.TransitGateways[r.Target]; !ok {
+		return false
+	}
+	var atts []string
+	for att, a := range g.Peering.TgwAttachments {
+		if a.TransitGateway == r.Target && a.Vpc == fromVpc {
+			atts = append(atts, att)
+		}
+	}
+	sort.Strings(atts)
+	for _, att := range atts {
+		rt, ok := g.tgwAssociation(att)
+		if !ok {
+			continue
+		}
+		if tr, ok := g.longestRoute(rt, cidr); ok && tr.Kind != "blackhole" {
+			if a := g.Peering.TgwAttachments[tr.Target]; a.TransitGateway == r.Target && a.Vpc == toVpc {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// once every resource is evaluated, remove the traffic the security groups allow between vpcs
+// but the routes don't carry, both ways, through a peering connection or a transit gateway
+func evalVpcPeering(thisGraph *graph) error {
+	thisGraph.propagateTgwRoutes()
+
+	removed := map[int]bool{}
+	for i, e := range *thisGraph.CytoscapeData {
+		if _, ok := thisGraph.Edges.Ports[edgeKey(e.Data.Source, e.Data.Target)]; e.Data.NodeType != "edge" || !ok {
+			continue // a node, or an edge that carries no traffic
+		}
+		srcSubnet, srcVpc := thisGraph.placement(e.Data.Source)
+		dstSubnet, dstVpc := thisGraph.placement(e.Data.Target)
+		if srcVpc == "" || dstVpc == "" || srcVpc == dstVpc {
+			continue
+		}
+		if !thisGraph.routesBetween(srcSubnet, srcVpc, dstSubnet, dstVpc) || !thisGraph.routesBetween(dstSubnet, dstVpc, srcSubnet, srcVpc) {
+			thisGraph.warn("no route between the vpcs of %s and %s", e.Data.Source, e.Data.Target)
+			removed[i] = true
+		}
+	}
+	thisGraph.removeElements(removed)
+	return nil
+}
@@ -0,0 +1,528 @@
+package tfviz
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/terraform-providers/terraform-provider-aws/aws"
+)
+
+// the subset of the `terraform show -json` plan representation used to build the graph.
+// See https://www.terraform.io/docs/internals/json-format.html
+type jsonPlan struct {
+	FormatVersion   string               `json:"format_version"`
+	PlannedValues   jsonPlanValues       `json:"planned_values"`
+	PriorState      *jsonPlanState       `json:"prior_state"`
+	ResourceChanges []jsonResourceChange `json:"resource_changes"`
+	Configuration   jsonPlanConfig       `json:"configuration"`
+	Variables       map[string]struct {
+		Value interface{} `json:"value"`
+	} `json:"variables"`
+}
+
+type jsonPlanState struct {
+	Values jsonPlanValues `json:"values"`
+}
+
+type jsonPlanValues struct {
+	RootModule jsonPlanModule `json:"root_module"`
+}
+
+type jsonPlanModule struct {
+	Address      string             `json:"address"`
+	Resources    []jsonPlanResource `json:"resources"`
+	ChildModules []jsonPlanModule   `json:"child_modules"`
+}
+
+type jsonPlanResource struct {
+	Address string                 `json:"address"`
+	Mode    string                 `json:"mode"`
+	Type    string                 `json:"type"`
+	Name    string                 `json:"name"`
+	Index   interface{}            `json:"index"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+type jsonResourceChange struct {
+	Address string `json:"address"`
+	Change  struct {
+		Actions      []string    `json:"actions"`
+		AfterUnknown interface{} `json:"after_unknown"`
+	} `json:"change"`
+}
+
+type jsonPlanConfig struct {
+	ProviderConfig map[string]jsonProviderConfig `json:"provider_config"`
+	RootModule     jsonConfigModule              `json:"root_module"`
+}
+
+type jsonProviderConfig struct {
+	ModuleAddress string                 `json:"module_address"`
+	Expressions   map[string]interface{} `json:"expressions"`
+}
+
+type jsonConfigModule struct {
+	Resources   []jsonConfigResource      `json:"resources"`
+	ModuleCalls map[string]jsonModuleCall `json:"module_calls"`
+	Outputs     map[string]struct {
+		Expression map[string]interface{} `json:"expression"`
+	} `json:"outputs"`
+}
+
+type jsonConfigResource struct {
+	Address           string                 `json:"address"`
+	ProviderConfigKey string                 `json:"provider_config_key"`
+	Expressions       map[string]interface{} `json:"expressions"`
+}
+
+type jsonModuleCall struct {
+	Expressions map[string]interface{} `json:"expressions"`
+	Module      jsonConfigModule       `json:"module"`
+}
+
+// a module instance of the plan, with the configuration it was created from
+type planScope struct {
+	path   []string // as in terraform.InstanceInfo.ModulePath
+	config *jsonConfigModule
+	parent *planScope
+	call   *jsonModuleCall // the call in parent that created this module
+}
+
+func (s *planScope) child(name string) *planScope {
+	call, ok := s.config.ModuleCalls[name]
+	if !ok {
+		return nil
+	}
+	return &planScope{
+		path:   append(append([]string{}, s.path...), name),
+		config: &call.Module,
+		parent: s,
+		call:   &call,
+	}
+}
+
+type planReader struct {
+	root      *planScope
+	unknown   map[string]interface{} // instance address -> after_unknown
+	ids       map[string]string      // resource id -> qualified instance address
+	instances map[string][]string    // qualified resource address -> its instance addresses
+	regions   map[string]string      // provider config key, e.g. "aws.west" -> its region, where known
+}
+
+// PlanToCytoscape is the cytoscape JSON of the plan printed by terraform show -json
+func PlanToCytoscape(raw string) *CytoscapeResult {
+	thisGraph, err := planToGraph(raw)
+	return formatResult(thisGraph, err, cytoscapeJSON)
+}
+
+// planToGraph builds the network graph from the JSON plan representation printed by
+// `terraform show -json <planfile>`.  Attributes are taken from the planned values, so real
+// ids of existing resources are resolved to the resources that own them; attributes only
+// known after apply are resolved through the references in the plan's configuration.
+func planToGraph(raw string) (*graph, error) {
+	instances, err := readJSONPlan([]byte(raw))
+	if err != nil {
+		return nil, &stageError{Stage: stageLoad, Err: err}
+	}
+	return instancesToGraph(instances)
+}
+
+func readJSONPlan(raw []byte) ([]*resourceInstance, error) {
+	var plan jsonPlan
+	if err := json.Unmarshal(raw, &plan); err != nil {
+		return nil, fmt.Errorf("Error reading JSON plan: %s", err)
+	}
+	if plan.FormatVersion == "" {
+		return nil, fmt.Errorf("Error reading JSON plan: no format_version, is this `terraform show -json` output?")
+	}
+	if major := strings.SplitN(plan.FormatVersion, ".", 2)[0]; major != "0" && major != "1" {
+		return nil, fmt.Errorf("Error reading JSON plan: unsupported format_version %s", plan.FormatVersion)
+	}
+
+	r := &planReader{
+		root:      &planScope{path: []string{"root"}, config: &plan.Configuration.RootModule},
+		unknown:   map[string]interface{}{},
+		ids:       map[string]string{},
+		instances: map[string][]string{},
+		regions:   map[string]string{},
+	}
+	for key, pc := range plan.Configuration.ProviderConfig {
+		region, _ := pc.Expressions["region"].(map[string]interface{})
+		if v, ok := region["constant_value"].(string); ok {
+			r.regions[key] = v
+		} else if refs, _ := region["references"].([]interface{}); len(refs) > 0 && pc.ModuleAddress == "" {
+			// only the root module's variables are in the plan
+			if ref, _ := refs[0].(string); strings.HasPrefix(ref, "var.") {
+				if v, ok := plan.Variables[strings.TrimPrefix(ref, "var.")].Value.(string); ok {
+					r.regions[key] = v
+				}
+			}
+		}
+	}
+	for _, rc := range plan.ResourceChanges {
+		r.unknown[rc.Address] = rc.Change.AfterUnknown
+	}
+	if plan.PriorState != nil {
+		r.index(&plan.PriorState.Values.RootModule)
+	}
+	r.index(&plan.PlannedValues.RootModule)
+
+	var instances []*resourceInstance
+	r.walk(&plan.PlannedValues.RootModule, func(scope *planScope, res *jsonPlanResource) {
+		if res.Mode != "managed" {
+			return
+		}
+		instances = append(instances, r.instance(scope, res))
+	})
+	return instances, nil
+}
+
+// record the ids and addresses of every resource in mod
+func (r *planReader) index(mod *jsonPlanModule) {
+	r.walk(mod, func(scope *planScope, res *jsonPlanResource) {
+		id, resource := planInstanceID(res)
+		addr := modulePath(scope.path, id)
+		resource = modulePath(scope.path, resource)
+		if !containsString(r.instances[resource], addr) {
+			r.instances[resource] = append(r.instances[resource], addr)
+		}
+		if id, ok := res.Values["id"].(string); ok && id != "" && res.Mode == "managed" {
+			r.ids[id] = addr
+		}
+	})
+}
+
+// call fn for each resource in mod and its child modules
+func (r *planReader) walk(mod *jsonPlanModule, fn func(*planScope, *jsonPlanResource)) {
+	var visit func(*planScope, *jsonPlanModule)
+	visit = func(scope *planScope, mod *jsonPlanModule) {
+		for i := range mod.Resources {
+			fn(scope, &mod.Resources[i])
+		}
+		for i := range mod.ChildModules {
+			child := &mod.ChildModules[i]
+			if s := r.scope(child.Address); s != nil {
+				visit(s, child)
+			}
+		}
+	}
+	visit(r.root, mod)
+}
+
+// find the scope of a module address, e.g. "module.network.module.subnets"
+func (r *planReader) scope(address string) *planScope {
+	s := r.root
+	for _, step := range strings.Split(address, ".module.") {
+		name := dottedAddress(strings.TrimPrefix(step, "module."))
+		if i := strings.Index(name, "."); i >= 0 {
+			// an instance of a module with count or for_each
+			name = name[:i]
+		}
+		if s = s.child(name); s == nil {
+			return nil
+		}
+	}
+	return s
+}
+
+// instance and resource ids of res, relative to its module, e.g. "aws_subnet.a[1]" and "aws_subnet.a"
+func planInstanceID(res *jsonPlanResource) (string, string) {
+	resource := res.Type + "." + res.Name
+	if res.Mode == "data" {
+		resource = "data." + resource
+	}
+	switch key := res.Index.(type) {
+	case float64:
+		return instanceAddress(resource, int(key)), resource
+	case string:
+		return instanceAddress(resource, key), resource
+	}
+	return resource, resource
+}
+
+func (r *planReader) instance(scope *planScope, res *jsonPlanResource) *resourceInstance {
+	id, resource := planInstanceID(res)
+
+	var expressions map[string]interface{}
+	var region string
+	for _, cr := range scope.config.Resources {
+		if cr.Address == resource {
+			expressions = cr.Expressions
+			region = r.region(cr.ProviderConfigKey)
+		}
+	}
+	cfg := r.resolve(scope, res.Type, nil, res.Values, r.unknown[res.Address], expressions).(map[string]interface{})
+	delete(cfg, "id")
+
+	return &resourceInstance{
+		Info: &terraform.InstanceInfo{
+			Id:         id,
+			ModulePath: scope.path,
+			Type:       res.Type,
+		},
+		Resource:  modulePath(scope.path, resource),
+		Config:    cfg,
+		DependsOn: interpolatedResources(cfg),
+		Region:    region,
+	}
+}
+
+// the region of a provider config.  Older plans key the configs a module inherits by the
+// module, e.g. "child:aws", so those fall back to the root module's.
+func (r *planReader) region(key string) string {
+	if region, ok := r.regions[key]; ok {
+		return region
+	}
+	if i := strings.LastIndex(key, ":"); i >= 0 {
+		return r.regions[key[i+1:]]
+	}
+	return ""
+}
+
+// resolve the planned value v of the attribute at path of a resource of type resourceType, e.g.
+// network_interfaces.security_groups.  unknown and expr are the matching parts of after_unknown
+// and the configuration expressions.  Ids of other resources become references to them, and
+// values only known after apply are replaced by the references in expr.
+func (r *planReader) resolve(scope *planScope, resourceType string, path []string, v, unknown, expr interface{}) interface{} {
+	if u, ok := unknown.(bool); ok && u {
+		refs := r.references(scope, expr)
+		switch {
+		case len(refs) == 0:
+			return nil
+		case !isListAttribute(resourceType, path, expr, refs):
+			// which one is only known after apply, e.g. element(aws_subnet.a.*.id, count.index)
+			return refs[0]
+		}
+		// lists and sets of references, e.g. vpc_security_group_ids
+		list := make([]interface{}, len(refs))
+		for i, ref := range refs {
+			list[i] = ref
+		}
+		return list
+	}
+	if u, ok := unknown.([]interface{}); ok && v == nil {
+		v = make([]interface{}, len(u)) // a list of known length whose elements are all unknown
+	}
+
+	switch t := v.(type) {
+	case string:
+		return resolveIDs(t, r.ids)
+	case map[string]interface{}:
+		u, _ := unknown.(map[string]interface{})
+		e, _ := expr.(map[string]interface{})
+		if isExpression(e) {
+			e = nil
+		}
+		m := map[string]interface{}{}
+		for k, ev := range t {
+			m[k] = r.resolve(scope, resourceType, append(path[:len(path):len(path)], k), ev, u[k], e[k])
+		}
+		for k, ue := range u {
+			if _, ok := t[k]; !ok {
+				m[k] = r.resolve(scope, resourceType, append(path[:len(path):len(path)], k), nil, ue, e[k])
+			}
+		}
+		return m
+	case []interface{}:
+		u, _ := unknown.([]interface{})
+		e, _ := expr.([]interface{})
+		// an expression for the whole list, e.g. [aws_subnet.a.id, aws_subnet.b.id], gives the
+		// unknown elements their references in order
+		refs := r.references(scope, expr)
+		list := make([]interface{}, 0, len(t))
+		for i, ev := range t {
+			var ue, ee interface{}
+			if i < len(u) {
+				ue = u[i]
+			}
+			if i < len(e) {
+				ee = e[i]
+			}
+			if ue == true && ee == nil && i < len(refs) {
+				list = append(list, refs[i])
+				continue
+			}
+			list = append(list, r.resolve(scope, resourceType, path, ev, ue, ee))
+		}
+		return list
+	}
+	return v
+}
+
+// the schemas of the resource types of the providers linked in, loaded on first use
+var providerSchemas map[string]*schema.Resource
+
+// whether the attribute at path of a resource type holds a list or a set.  That is up to the
+// schema of its provider when it is linked in, like aws, else to its expression expr: refs to
+// several resources, e.g. [aws_subnet.a.id, aws_subnet.b.id] or aws_subnet.a.*.id, unless
+// count.index or each picks one of them.
+func isListAttribute(resourceType string, path []string, expr interface{}, refs []string) bool {
+	if providerSchemas == nil {
+		providerSchemas = map[string]*schema.Resource{}
+		if p, ok := aws.Provider().(*schema.Provider); ok {
+			for t, res := range p.ResourcesMap {
+				providerSchemas[t] = res
+			}
+		}
+	}
+	if res, ok := providerSchemas[resourceType]; ok {
+		for i, name := range path {
+			attr, ok := res.Schema[name]
+			if !ok {
+				break
+			}
+			if i == len(path)-1 {
+				return attr.Type == schema.TypeList || attr.Type == schema.TypeSet
+			}
+			if res, ok = attr.Elem.(*schema.Resource); !ok {
+				break
+			}
+		}
+	}
+
+	e, _ := expr.(map[string]interface{})
+	raw, _ := e["references"].([]interface{})
+	for _, ref := range raw {
+		if s, _ := ref.(string); strings.HasPrefix(s, "count.") || strings.HasPrefix(s, "each.") {
+			return false
+		}
+	}
+	return len(refs) > 1
+}
+
+// an expression object as opposed to a nested block
+func isExpression(m map[string]interface{}) bool {
+	_, refs := m["references"]
+	_, constant := m["constant_value"]
+	return refs || constant
+}
+
+// the references of an expression object as legacy interpolations, e.g. "${aws_vpc.main.id}"
+func (r *planReader) references(scope *planScope, expr interface{}) []string {
+	var addrs []string
+	referenced := r.referencedAddresses(scope, expr)
+	for _, addr := range referenced {
+		if instances, ok := r.instances[addr]; ok && !referencesInstance(referenced, addr) {
+			// a whole resource refers to all of its instances
+			for _, inst := range instances {
+				addrs = append(addrs, inst+".id")
+			}
+			continue
+		}
+		if r.isInstance(addr) {
+			addr += ".id"
+		}
+		addrs = append(addrs, addr)
+	}
+
+	// newer terraform lists every prefix of a reference, e.g. aws_vpc.main.id and aws_vpc.main
+	var refs []string
+	for _, addr := range addrs {
+		prefix := false
+		for _, other := range addrs {
+			if strings.HasPrefix(other, addr+".") {
+				prefix = true
+			}
+		}
+		if !prefix && !containsString(refs, "${"+addr+"}") {
+			refs = append(refs, "${"+addr+"}")
+		}
+	}
+	return refs
+}
+
+func (r *planReader) isInstance(addr string) bool {
+	return containsString(r.instances[resourceAddress(addr)], addr)
+}
+
+// whether addrs holds a reference to one of the instances of resource, which newer terraform
+// lists along with the resource itself, e.g. aws_subnet.a[0] and aws_subnet.a
+func referencesInstance(addrs []string, resource string) bool {
+	for _, addr := range addrs {
+		if strings.HasPrefix(addr, resource+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// qualified addresses of the resources referenced by expr, following module variables and outputs
+func (r *planReader) referencedAddresses(scope *planScope, expr interface{}) []string {
+	e, _ := expr.(map[string]interface{})
+	raw, _ := e["references"].([]interface{})
+
+	var addrs []string
+	for _, ref := range raw {
+		s, ok := ref.(string)
+		if !ok {
+			continue
+		}
+		parts := strings.Split(dottedAddress(s), ".")
+		switch parts[0] {
+		case "var":
+			if scope.call != nil && len(parts) > 1 {
+				addrs = append(addrs, r.referencedAddresses(scope.parent, scope.call.Expressions[parts[1]])...)
+			}
+		case "module":
+			if len(parts) < 3 {
+				continue
+			}
+			if child := scope.child(parts[1]); child != nil {
+				if output, ok := child.config.Outputs[parts[2]]; ok {
+					addrs = append(addrs, r.referencedAddresses(child, output.Expression)...)
+				}
+			}
+		case "local", "count", "each", "path", "terraform", "self", "data":
+		default:
+			addrs = append(addrs, modulePath(scope.path, s))
+		}
+	}
+	return addrs
+}
+
+var addressIndex = regexp.MustCompile(`\["?([^"\]]*)"?\]`)
+
+// convert an address into dotted form, e.g. module.net["x"].aws_subnet.a -> module.net.x.aws_subnet.a,
+// to split it into its parts
+func dottedAddress(addr string) string {
+	return addressIndex.ReplaceAllString(addr, ".$1")
+}
+
+// resources referenced by the interpolations in cfg
+func interpolatedResources(cfg interface{}) []string {
+	var deps []string
+	var visit func(interface{})
+	visit = func(v interface{}) {
+		switch t := v.(type) {
+		case string:
+			if isInterpolated(t) {
+				deps = append(deps, strip(t))
+			}
+		case map[string]interface{}:
+			for _, e := range t {
+				visit(e)
+			}
+		case []interface{}:
+			for _, e := range t {
+				visit(e)
+			}
+		}
+	}
+	visit(cfg)
+	sort.Strings(deps)
+	return deps
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
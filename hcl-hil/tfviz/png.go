@@ -0,0 +1,46 @@
+// +build !js
+
+package tfviz
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// the converter turning the SVG image into a PNG one, from librsvg
+var pngConverter = "rsvg-convert"
+
+func init() {
+	formats["png"] = pngImage
+	binaryFormats["png"] = true
+}
+
+// whether the converter is installed, checked before loading anything
+func checkPngConverter() error {
+	if _, err := exec.LookPath(pngConverter); err != nil {
+		return &stageError{Stage: stageLoad, Err: fmt.Errorf("-format png needs %s from librsvg: %s", pngConverter, err)}
+	}
+	return nil
+}
+
+// the diagram as a PNG image: the SVG image, rasterized by rsvg-convert
+func pngImage(thisGraph *graph) (string, error) {
+	svg, err := svgImage(thisGraph)
+	if err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(pngConverter, "--format", "png")
+	cmd.Stdin = strings.NewReader(svg)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%s: %s", err, msg)
+		}
+		return "", &stageError{Stage: stageGraphBuild, Err: fmt.Errorf("running %s (from librsvg): %s", pngConverter, err)}
+	}
+	return stdout.String(), nil
+}
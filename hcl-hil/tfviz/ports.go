@@ -0,0 +1,222 @@
+package tfviz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// names of the protocol numbers security group rules accept in place of a name
+var protocolNames = map[string]string{
+	"-1": "all",
+	"1":  "icmp",
+	"6":  "tcp",
+	"17": "udp",
+	"58": "icmpv6",
+}
+
+// portRange is a range of ports of one protocol allowed by a security group rule.  For icmp
+// the range holds icmp types instead of ports.
+type portRange struct {
+	Protocol string
+	From     int
+	To       int
+}
+
+// the full range of ports (or icmp types) of a protocol
+func fullRange(protocol string) (int, int) {
+	switch protocol {
+	case "icmp", "icmpv6":
+		return 0, 255
+	}
+	return 0, 65535
+}
+
+func (r portRange) String() string {
+	from, to := fullRange(r.Protocol)
+	switch {
+	case r.Protocol == "all", r.From == from && r.To == to:
+		return r.Protocol
+	case r.From == r.To:
+		return fmt.Sprintf("%s/%d", r.Protocol, r.From)
+	}
+	return fmt.Sprintf("%s/%d-%d", r.Protocol, r.From, r.To)
+}
+
+// portSet is a sorted list of non overlapping port ranges
+type portSet []portRange
+
+// the ports allowed by an ingress/egress block or an aws_security_group_rule.  nil means the
+// rule's ports or protocol aren't known, e.g. because they are set from a variable.
+func rulePorts(rule map[string]interface{}) portSet {
+	p, ok := rule["protocol"]
+	if !ok {
+		return nil
+	}
+	protocol := strings.ToLower(fmt.Sprint(p))
+	if name, ok := protocolNames[protocol]; ok {
+		protocol = name
+	}
+	if isInterpolated(protocol) {
+		return nil
+	}
+	if protocol == "all" {
+		return portSet{{Protocol: protocol}}
+	}
+
+	min, max := fullRange(protocol)
+	switch protocol {
+	case "tcp", "udp", "icmp", "icmpv6":
+	default:
+		// ports only mean something to the protocols above
+		return portSet{{Protocol: protocol, From: min, To: max}}
+	}
+
+	from, ok1 := portNumber(rule["from_port"])
+	to, ok2 := portNumber(rule["to_port"])
+	if !ok1 || !ok2 {
+		return nil
+	}
+	if from < min || to > max || to < from {
+		// -1, i.e. every icmp type
+		from, to = min, max
+	}
+	return portSet{{Protocol: protocol, From: from, To: to}}
+}
+
+// a port, e.g. from_port = 22 or "22"
+func portNumber(v interface{}) (int, bool) {
+	return intValue(v)
+}
+
+// union of s and other, with overlapping and adjacent ranges combined
+func (s portSet) merge(other portSet) portSet {
+	all := append(append(portSet{}, s...), other...)
+	for _, r := range all {
+		if r.Protocol == "all" {
+			return portSet{r}
+		}
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Protocol != all[j].Protocol {
+			return all[i].Protocol < all[j].Protocol
+		}
+		return all[i].From < all[j].From
+	})
+
+	merged := portSet{all[0]}
+	for _, r := range all[1:] {
+		last := &merged[len(merged)-1]
+		if r.Protocol == last.Protocol && r.From <= last.To+1 {
+			if r.To > last.To {
+				last.To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func (s portSet) strings() []string {
+	var list []string
+	for _, r := range s {
+		list = append(list, r.String())
+	}
+	return list
+}
+
+// key of an edge in the maps of the graph struct
+func edgeKey(source string, target string) string {
+	return source + " -> " + target
+}
+
+// protocols "all" stands for when intersecting and subtracting port sets
+var allProtocols = []string{"icmp", "tcp", "udp"}
+
+// s with "all" replaced by the full range of each of allProtocols
+func (s portSet) expand() portSet {
+	for _, r := range s {
+		if r.Protocol == "all" {
+			var expanded portSet
+			for _, protocol := range allProtocols {
+				from, to := fullRange(protocol)
+				expanded = append(expanded, portRange{Protocol: protocol, From: from, To: to})
+			}
+			return expanded
+		}
+	}
+	return s
+}
+
+// the inverse of expand
+func (s portSet) collapse() portSet {
+	full := 0
+	for _, r := range s {
+		for _, protocol := range allProtocols {
+			from, to := fullRange(protocol)
+			if r.Protocol == protocol && r.From == from && r.To == to {
+				full++
+			}
+		}
+	}
+	if full == len(allProtocols) {
+		return portSet{{Protocol: "all"}}
+	}
+	return s
+}
+
+// ports in both s and other
+func (s portSet) intersect(other portSet) portSet {
+	var both portSet
+	for _, a := range s.expand() {
+		for _, b := range other.expand() {
+			if a.Protocol != b.Protocol {
+				continue
+			}
+			from, to := a.From, a.To
+			if b.From > from {
+				from = b.From
+			}
+			if b.To < to {
+				to = b.To
+			}
+			if from <= to {
+				both = append(both, portRange{Protocol: a.Protocol, From: from, To: to})
+			}
+		}
+	}
+	return portSet{}.merge(both).collapse()
+}
+
+// ports in s but not in other
+func (s portSet) subtract(other portSet) portSet {
+	var rest portSet
+	for _, a := range s.expand() {
+		pieces := portSet{a}
+		for _, b := range other.expand() {
+			if b.Protocol != a.Protocol {
+				continue
+			}
+			var next portSet
+			for _, p := range pieces {
+				if b.To < p.From || b.From > p.To {
+					next = append(next, p)
+					continue
+				}
+				if b.From > p.From {
+					next = append(next, portRange{Protocol: p.Protocol, From: p.From, To: b.From - 1})
+				}
+				if b.To < p.To {
+					next = append(next, portRange{Protocol: p.Protocol, From: b.To + 1, To: p.To})
+				}
+			}
+			pieces = next
+		}
+		rest = append(rest, pieces...)
+	}
+	return portSet{}.merge(rest).collapse()
+}
@@ -0,0 +1,98 @@
+package tfviz
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// a port set written the way portRange.String writes it, e.g. "tcp/80", "tcp/1024-65535", "udp"
+// or "all"
+func parsePorts(t *testing.T, specs ...string) portSet {
+	var s portSet
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "/", 2)
+		r := portRange{Protocol: parts[0]}
+		if r.Protocol != "all" {
+			r.From, r.To = fullRange(r.Protocol)
+		}
+		if len(parts) == 2 {
+			bounds := strings.SplitN(parts[1], "-", 2)
+			from, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.From, r.To = from, from
+			if len(bounds) == 2 {
+				if r.To, err = strconv.Atoi(bounds[1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		s = append(s, r)
+	}
+	return s
+}
+
+func TestPortSetAlgebra(t *testing.T) {
+	tests := []struct {
+		op   string
+		a, b []string
+		want string
+	}{
+		{"merge", []string{"tcp/80"}, []string{"tcp/81"}, "tcp/80-81"},
+		{"merge", []string{"tcp/1-10"}, []string{"tcp/5-20"}, "tcp/1-20"},
+		{"merge", []string{"tcp/80"}, []string{"tcp/443"}, "tcp/80, tcp/443"},
+		{"merge", []string{"udp/53"}, []string{"tcp/80"}, "tcp/80, udp/53"},
+		{"merge", []string{"tcp/80"}, []string{"all"}, "all"},
+		{"merge", nil, nil, ""},
+		{"intersect", []string{"tcp/1-100"}, []string{"tcp/50-200"}, "tcp/50-100"},
+		{"intersect", []string{"all"}, []string{"tcp/443"}, "tcp/443"},
+		{"intersect", []string{"tcp/80"}, []string{"udp/80"}, ""},
+		{"intersect", []string{"all"}, []string{"all"}, "all"},
+		{"intersect", []string{"tcp/22", "tcp/80"}, []string{"tcp/0-79"}, "tcp/22"},
+		{"subtract", []string{"tcp/1-100"}, []string{"tcp/50"}, "tcp/1-49, tcp/51-100"},
+		{"subtract", []string{"all"}, []string{"tcp"}, "icmp, udp"},
+		{"subtract", []string{"all"}, []string{"tcp/0-1023"}, "icmp, tcp/1024-65535, udp"},
+		{"subtract", []string{"tcp/80"}, []string{"all"}, ""},
+		{"subtract", []string{"tcp/80"}, []string{"udp/80"}, "tcp/80"},
+		{"subtract", []string{"all"}, nil, "all"},
+	}
+	for _, tt := range tests {
+		a, b := parsePorts(t, tt.a...), parsePorts(t, tt.b...)
+		var got portSet
+		switch tt.op {
+		case "merge":
+			got = a.merge(b)
+		case "intersect":
+			got = a.intersect(b)
+		case "subtract":
+			got = a.subtract(b)
+		}
+		if s := strings.Join(got.strings(), ", "); s != tt.want {
+			t.Errorf("%v %s %v = %q, want %q", tt.a, tt.op, tt.b, s, tt.want)
+		}
+	}
+}
+
+func TestRulePorts(t *testing.T) {
+	tests := []struct {
+		rule map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"protocol": "-1", "from_port": 0, "to_port": 0}, "all"},
+		{map[string]interface{}{"protocol": "tcp", "from_port": 22, "to_port": 22}, "tcp/22"},
+		{map[string]interface{}{"protocol": "6", "from_port": "8000", "to_port": "8080"}, "tcp/8000-8080"},
+		{map[string]interface{}{"protocol": "UDP", "from_port": 0, "to_port": 65535}, "udp"},
+		{map[string]interface{}{"protocol": "icmp", "from_port": -1, "to_port": -1}, "icmp"},
+		{map[string]interface{}{"protocol": "47"}, "47"},
+		{map[string]interface{}{"protocol": "tcp", "from_port": "${var.port}", "to_port": 443}, ""},
+		{map[string]interface{}{"protocol": "${var.protocol}", "from_port": 443, "to_port": 443}, ""},
+		{map[string]interface{}{"from_port": 443, "to_port": 443}, ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(rulePorts(tt.rule).strings(), ", "); got != tt.want {
+			t.Errorf("rulePorts(%v) = %q, want %q", tt.rule, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package tfviz
+
+import (
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// dbCluster is where the instances of an aws_rds_cluster are placed: the subnets of its subnet
+// group and its security groups
+type dbCluster struct {
+	Subnets        []string
+	SecurityGroups []string
+}
+
+// rdsState is where the databases go
+type rdsState struct {
+	SubnetGroups map[string][]string  // db subnet group, by address and by literal name -> subnets
+	Clusters     map[string]dbCluster // aws_rds_cluster -> subnets and security groups of its instances
+}
+
+func newRdsState() rdsState {
+	return rdsState{
+		SubnetGroups: make(map[string][]string),
+		Clusters:     make(map[string]dbCluster),
+	}
+}
+
+// the subnets of the subnet group a database or cluster is placed in.  Subnet groups are looked
+// up by reference, or by their literal name, which only works when nothing else orders them
+// first, like terraform itself without a depends_on.
+func dbSubnets(ii *terraform.InstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) []string {
+	p, ok := c.Get("db_subnet_group_name")
+	if !ok {
+		return nil
+	}
+	name := p.(string)
+	if !isInterpolated(name) {
+		return thisGraph.Rds.SubnetGroups[name]
+	}
+	return thisGraph.Rds.SubnetGroups[stripAttribute(ii, name, "name", "arn")]
+}
+
+func dbSecurityGroups(ii *terraform.InstanceInfo, c *terraform.ResourceConfig) []string {
+	var sgs []string
+	if p, ok := c.Get("vpc_security_group_ids"); ok {
+		for _, sg := range p.([]interface{}) {
+			sgs = append(sgs, modulePath(ii.ModulePath, strip(sg.(string))))
+		}
+	}
+	return sgs
+}
+
+// the subnets of a subnet group a database instance is drawn in: the one of its
+// availability_zone when that is set, else the first one, and for a multi_az database a
+// standby in a second one, of another zone when the zones are known
+func dbPlacement(c *terraform.ResourceConfig, subnets []string, thisGraph *graph) []string {
+	if len(subnets) == 0 {
+		return nil
+	}
+	if p, ok := c.Get("availability_zone"); ok && !isInterpolated(p.(string)) {
+		for _, sub := range subnets {
+			if thisGraph.SubnetZones[sub] == p.(string) {
+				return []string{sub}
+			}
+		}
+	}
+	placed := []string{subnets[0]}
+	if p, ok := c.Get("multi_az"); ok && (p == true || p == "true") && len(subnets) > 1 {
+		standby := subnets[1]
+		for _, sub := range subnets[1:] {
+			if az := thisGraph.SubnetZones[sub]; az != "" && az != thisGraph.SubnetZones[subnets[0]] {
+				standby = sub
+				break
+			}
+		}
+		placed = append(placed, standby)
+	}
+	return placed
+}
+
+// draw RDS databases in their subnet group, placed by dbPlacement, with the reachability of
+// their security groups.  Read replicas are linked to the database they
+// replicate.  A cluster is drawn through its aws_rds_cluster_instance resources, which take the
+// cluster's subnets and security groups, except for serverless clusters, which have none.
+func evalRdsResource(info *cytoInstanceInfo, c *terraform.ResourceConfig, g *dag.Graph, thisGraph *graph) error {
+	ii := info.II
+
+	switch ii.Type {
+	case "aws_db_subnet_group":
+		var subnets []string
+		if p, ok := c.Get("subnet_ids"); ok {
+			for _, sub := range p.([]interface{}) {
+				subnets = append(subnets, modulePath(ii.ModulePath, strip(sub.(string))))
+			}
+		}
+		thisGraph.Rds.SubnetGroups[info.ID] = subnets
+		if p, ok := c.Get("name"); ok && !isInterpolated(p.(string)) {
+			thisGraph.Rds.SubnetGroups[p.(string)] = subnets
+		}
+
+	case "aws_db_instance":
+		subnets := dbSubnets(ii, c, thisGraph)
+		var source string
+		if p, ok := c.Get("replicate_source_db"); ok && isInterpolated(p.(string)) {
+			source = stripAttribute(ii, p.(string), "identifier", "arn")
+		}
+		sources := thisGraph.Clones[source]
+		if subnets == nil {
+			// a replica in the same region is placed in the subnet group of its source
+			for _, clone := range sources {
+				subnets = append(subnets, thisGraph.Topology.Parent(clone))
+			}
+		}
+		clones, err := cloneBySubnet(info, c, dbPlacement(c, subnets, thisGraph), dbSecurityGroups(ii, c), g, thisGraph)
+		if err != nil {
+			return err
+		}
+		if len(sources) > 0 && len(clones) > 0 {
+			thisGraph.addLabelledEdge(sources[0], clones[0], "replication")
+		}
+
+	case "aws_rds_cluster":
+		cluster := dbCluster{Subnets: dbSubnets(ii, c, thisGraph), SecurityGroups: dbSecurityGroups(ii, c)}
+		thisGraph.Rds.Clusters[info.ID] = cluster
+		if p, ok := c.Get("engine_mode"); ok && p == "serverless" {
+			if _, err := cloneBySubnet(info, c, dbPlacement(c, cluster.Subnets, thisGraph), cluster.SecurityGroups, g, thisGraph); err != nil {
+				return err
+			}
+		}
+
+	case "aws_rds_cluster_instance":
+		p, ok := c.Get("cluster_identifier")
+		if !ok {
+			return nil
+		}
+		cluster, ok := thisGraph.Rds.Clusters[stripAttribute(ii, p.(string), "cluster_identifier", "arn")]
+		if !ok {
+			return nil // a cluster that wasn't evaluated
+		}
+		subnets := dbSubnets(ii, c, thisGraph)
+		if subnets == nil {
+			subnets = cluster.Subnets
+		}
+		if _, err := cloneBySubnet(info, c, dbPlacement(c, subnets, thisGraph), cluster.SecurityGroups, g, thisGraph); err != nil {
+			return err
+		}
+	}
+	return nil
+}
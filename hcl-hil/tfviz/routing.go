@@ -0,0 +1,307 @@
+package tfviz
+
+import (
+	"net"
+	"sort"
+
+	"github.com/hashicorp/terraform/dag"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// id of the node standing for everything outside the vpcs
+const internetID = "internet"
+
+// route is a single entry of a route table
+type route struct {
+	Destination string // cidr block
+	Target      string // resource the traffic is sent to, e.g. an aws_internet_gateway
+	Kind        string // attribute the target was set with, e.g. "gateway_id"
+}
+
+// routingState is the aws routing of traffic out of the subnets
+type routingState struct {
+	VpcCidrs        map[string]string  // vpc -> cidr block
+	Gateways        map[string]string  // internet or nat gateway -> its resource type
+	Routes          map[string][]route // route table -> routes, inline or from aws_route
+	RouteTableAssoc map[string]string  // subnet -> route table
+	MainRouteTables map[string]string  // vpc -> main route table
+}
+
+func newRoutingState() routingState {
+	return routingState{
+		VpcCidrs:        make(map[string]string),
+		Gateways:        make(map[string]string),
+		Routes:          make(map[string][]route),
+		RouteTableAssoc: make(map[string]string),
+		MainRouteTables: make(map[string]string),
+	}
+}
+
+// attributes of a route, in an aws_route or an inline route block, that name its target
+var routeTargets = []string{
+	"gateway_id",
+	"nat_gateway_id",
+	"egress_only_gateway_id",
+	"instance_id",
+	"network_interface_id",
+	"transit_gateway_id",
+	"vpc_peering_connection_id",
+}
+
+func (g *graph) addRoute(rt string, r route) {
+	g.Routing.Routes[rt] = append(g.Routing.Routes[rt], r)
+}
+
+// read a route from an aws_route (destKey "destination_cidr_block") or an inline route block
+// (destKey "cidr_block").  Routes without an ipv4 destination or a target are skipped.
+func routeOf(ii *terraform.InstanceInfo, m map[string]interface{}, destKey string) (route, bool) {
+	dest, ok := m[destKey].(string)
+	if !ok || dest == "" {
+		return route{}, false
+	}
+	for _, kind := range routeTargets {
+		if t, ok := m[kind].(string); ok && t != "" {
+			return route{
+				Destination: strip(dest),
+				Target:      modulePath(ii.ModulePath, strip(t)),
+				Kind:        kind,
+			}, true
+		}
+	}
+	return route{}, false
+}
+
+// add the nodes and routes of the routing resources.  Whether a subnet is public is only
+// decided by evalRouting, once every route and association is known.
+func evalRoutingResource(info *cytoInstanceInfo, c *terraform.ResourceConfig, thisGraph *graph) error {
+	ii := info.II
+
+	switch ii.Type {
+	case "aws_internet_gateway":
+		vpc := ""
+		if p, ok := c.Get("vpc_id"); ok {
+			vpc = modulePath(ii.ModulePath, strip(p.(string)))
+		}
+		if err := thisGraph.addNode(info, c, vpc, 0); err != nil {
+			return err
+		}
+		thisGraph.Routing.Gateways[info.ID] = ii.Type
+
+	case "aws_nat_gateway":
+		subnet := ""
+		if p, ok := c.Get("subnet_id"); ok {
+			subnet = modulePath(ii.ModulePath, strip(p.(string)))
+		}
+		if err := thisGraph.addNode(info, c, subnet, 0); err != nil {
+			return err
+		}
+		thisGraph.Routing.Gateways[info.ID] = ii.Type
+
+	case "aws_route_table":
+		vpc := ""
+		if p, ok := c.Get("vpc_id"); ok {
+			vpc = modulePath(ii.ModulePath, strip(p.(string)))
+		}
+		if err := thisGraph.addNode(info, c, vpc, 0); err != nil {
+			return err
+		}
+		if routes, ok := c.Get("route"); ok {
+			for _, m := range routes.([]map[string]interface{}) {
+				if r, ok := routeOf(ii, m, "cidr_block"); ok {
+					thisGraph.addRoute(info.ID, r)
+				}
+			}
+		}
+
+	case "aws_route":
+		if p, ok := c.Get("route_table_id"); ok {
+			if r, ok := routeOf(ii, c.Config, "destination_cidr_block"); ok {
+				thisGraph.addRoute(modulePath(ii.ModulePath, strip(p.(string))), r)
+			}
+		}
+
+	case "aws_route_table_association":
+		subnet, ok1 := c.Get("subnet_id")
+		rt, ok2 := c.Get("route_table_id")
+		if ok1 && ok2 {
+			thisGraph.Routing.RouteTableAssoc[modulePath(ii.ModulePath, strip(subnet.(string)))] = modulePath(ii.ModulePath, strip(rt.(string)))
+		}
+
+	case "aws_main_route_table_association":
+		vpc, ok1 := c.Get("vpc_id")
+		rt, ok2 := c.Get("route_table_id")
+		if ok1 && ok2 {
+			thisGraph.Routing.MainRouteTables[modulePath(ii.ModulePath, strip(vpc.(string)))] = modulePath(ii.ModulePath, strip(rt.(string)))
+		}
+	}
+	return nil
+}
+
+// the route table of a subnet: the one associated with it, or else the main table of its vpc
+func (g *graph) routeTable(subnet string) string {
+	if rt, ok := g.Routing.RouteTableAssoc[subnet]; ok {
+		return rt
+	}
+	return g.Routing.MainRouteTables[g.Topology.Parent(subnet)]
+}
+
+// the gateway of the given type the subnet routes traffic for cidr to, if any: the target of the
+// most specific route covering cidr, as long as it is such a gateway
+func (g *graph) routeTo(subnet string, cidr *net.IPNet, gatewayType string) (string, bool) {
+	r, ok := g.longestRoute(g.routeTable(subnet), cidr)
+	if !ok || g.Routing.Gateways[r.Target] != gatewayType {
+		return "", false
+	}
+	return r.Target, true
+}
+
+// the most specific route of a route table for the addresses of cidr.  Like on a transit
+// gateway, a static route wins over a propagated one to the same destination.
+func (g *graph) longestRoute(table string, cidr *net.IPNet) (route, bool) {
+	var best route
+	bestOnes := -1
+	size, _ := cidr.Mask.Size()
+	for _, r := range g.Routing.Routes[table] {
+		_, dest, err := net.ParseCIDR(r.Destination)
+		if err != nil {
+			continue
+		}
+		ones, _ := dest.Mask.Size()
+		if ones > size || !dest.Contains(cidr.IP) {
+			continue
+		}
+		if ones > bestOnes || ones == bestOnes && best.Kind == "propagated" {
+			best, bestOnes = r, ones
+		}
+	}
+	return best, bestOnes >= 0
+}
+
+// a subnet is public when it routes to an internet gateway
+func (g *graph) isPublicSubnet(subnet string) bool {
+	_, any, _ := net.ParseCIDR("0.0.0.0/0")
+	_, ok := g.routeTo(subnet, any, "aws_internet_gateway")
+	return ok
+}
+
+// cidrs of the sg pathing graph outside every vpc.  When no vpc cidr is known only 0.0.0.0/0
+// is taken as the internet.
+func (g *graph) isInternet(cidr *net.IPNet) bool {
+	ones, _ := cidr.Mask.Size()
+	if ones == 0 {
+		return true
+	}
+	if len(g.Routing.VpcCidrs) == 0 {
+		return false
+	}
+	for _, c := range g.Routing.VpcCidrs {
+		_, vpc, err := net.ParseCIDR(c)
+		if err != nil {
+			continue
+		}
+		if vpc.Contains(cidr.IP) || cidr.Contains(vpc.IP) {
+			return false
+		}
+	}
+	return true
+}
+
+// add the internet node, before the first edge to it
+func (g *graph) addInternet() {
+	if g.Topology.Has(internetID) {
+		return
+	}
+	node := cytoscapeNode{
+		Data: cytoscapeNodeBody{
+			ID:       internetID,
+			Name:     "Internet",
+			NodeType: "cloud",
+		},
+	}
+	*g.CytoscapeData = append(*g.CytoscapeData, node)
+	g.Topology.Place(internetID, internetID, "")
+}
+
+// once every resource is evaluated, draw the routes, and the traffic between the internet and
+// the instances the security groups allow and the routes make possible: in and out through an
+// internet gateway in public subnets, and out through a nat gateway in private ones.  Subnet
+// nodes are marked public or private for the formats to draw them apart.
+func evalRouting(g *dag.Graph, thisGraph *graph) error {
+	var tables []string
+	for rt := range thisGraph.Routing.Routes {
+		tables = append(tables, rt)
+	}
+	sort.Strings(tables)
+	for _, rt := range tables {
+		if !thisGraph.Topology.Has(rt) {
+			continue // routes of a table that isn't drawn
+		}
+		for _, r := range thisGraph.Routing.Routes[rt] {
+			if _, ok := thisGraph.Routing.Gateways[r.Target]; ok {
+				thisGraph.addLabelledEdge(rt, r.Target, r.Destination)
+			}
+		}
+	}
+
+	var associated []string
+	for subnet := range thisGraph.Routing.RouteTableAssoc {
+		associated = append(associated, subnet)
+	}
+	sort.Strings(associated)
+	for _, subnet := range associated {
+		rt := thisGraph.Routing.RouteTableAssoc[subnet]
+		if thisGraph.Topology.Has(subnet) && thisGraph.Topology.Has(rt) {
+			thisGraph.addLabelledEdge(subnet, rt, "")
+		}
+	}
+
+	for i := range *thisGraph.CytoscapeData {
+		n := &(*thisGraph.CytoscapeData)[i].Data
+		if n.NodeType == "aws_subnet" {
+			n.Public = thisGraph.isPublicSubnet(n.ID)
+		}
+	}
+
+	natPorts := map[string]portSet{}
+	for _, subnet := range thisGraph.Topology.SubnetIDs() {
+		for _, m := range thisGraph.Topology.SubnetMembers(subnet) {
+			for _, sg := range thisGraph.Topology.MemberGroups(m) {
+				for _, v := range g.UpEdges(sg).List() {
+					if _, cidr, err := net.ParseCIDR(v.(string)); err == nil && thisGraph.isInternet(cidr) {
+						if _, ok := thisGraph.routeTo(subnet, cidr, "aws_internet_gateway"); ok {
+							thisGraph.addInternet()
+							thisGraph.addEdge(internetID, m, thisGraph.sgEdgePorts(v.(string), sg))
+						}
+					}
+				}
+				for _, v := range g.DownEdges(sg).List() {
+					_, cidr, err := net.ParseCIDR(v.(string))
+					if err != nil || !thisGraph.isInternet(cidr) {
+						continue
+					}
+					ports := thisGraph.sgEdgePorts(sg, v.(string))
+					if _, ok := thisGraph.routeTo(subnet, cidr, "aws_internet_gateway"); ok {
+						thisGraph.addInternet()
+						thisGraph.addEdge(m, internetID, ports)
+					} else if nat, ok := thisGraph.routeTo(subnet, cidr, "aws_nat_gateway"); ok {
+						thisGraph.addEdge(m, nat, ports)
+						natPorts[nat] = natPorts[nat].merge(ports)
+					}
+				}
+			}
+		}
+	}
+
+	var nats []string
+	for nat := range natPorts {
+		nats = append(nats, nat)
+	}
+	sort.Strings(nats)
+	for _, nat := range nats {
+		if thisGraph.isPublicSubnet(thisGraph.Topology.Parent(nat)) {
+			thisGraph.addInternet()
+			thisGraph.addEdge(nat, internetID, natPorts[nat])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package tfviz
+
+import (
+	"net"
+	"testing"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+func TestRouteTo(t *testing.T) {
+	g := newGraph()
+	g.Topology.Place("aws_vpc.main", "aws_vpc", "")
+	g.Topology.Place("aws_subnet.pub", "aws_subnet", "aws_vpc.main")
+	g.Topology.Place("aws_subnet.priv", "aws_subnet", "aws_vpc.main")
+	g.Routing.Gateways["aws_internet_gateway.gw"] = "aws_internet_gateway"
+	g.Routing.Gateways["aws_nat_gateway.nat"] = "aws_nat_gateway"
+	g.Routing.RouteTableAssoc["aws_subnet.pub"] = "aws_route_table.pub"
+	g.Routing.MainRouteTables["aws_vpc.main"] = "aws_route_table.main"
+	g.Routing.Routes["aws_route_table.pub"] = []route{
+		{Destination: "0.0.0.0/0", Target: "aws_internet_gateway.gw", Kind: "gateway_id"},
+		{Destination: "192.168.0.0/16", Target: "aws_nat_gateway.nat", Kind: "nat_gateway_id"},
+		{Destination: "10.0.0.0/8", Target: "aws_internet_gateway.gw", Kind: "gateway_id"},
+	}
+	g.Routing.Routes["aws_route_table.main"] = []route{
+		{Destination: "172.16.0.0/12", Target: "aws_nat_gateway.nat", Kind: "nat_gateway_id"},
+	}
+
+	tests := []struct {
+		name        string
+		subnet      string
+		cidr        string
+		gatewayType string
+		want        string
+	}{
+		{"default route", "aws_subnet.pub", "0.0.0.0/0", "aws_internet_gateway", "aws_internet_gateway.gw"},
+		{"default route for a block", "aws_subnet.pub", "8.8.8.0/24", "aws_internet_gateway", "aws_internet_gateway.gw"},
+		{"more specific route wins", "aws_subnet.pub", "192.168.1.0/24", "aws_nat_gateway", "aws_nat_gateway.nat"},
+		{"more specific route to another type", "aws_subnet.pub", "192.168.1.0/24", "aws_internet_gateway", ""},
+		{"route inside the block doesn't cover it", "aws_subnet.priv", "0.0.0.0/0", "aws_nat_gateway", ""},
+		{"main route table", "aws_subnet.priv", "172.16.5.0/24", "aws_nat_gateway", "aws_nat_gateway.nat"},
+		{"no route", "aws_subnet.priv", "8.8.8.8/32", "aws_internet_gateway", ""},
+		{"unknown subnet", "aws_subnet.other", "0.0.0.0/0", "aws_internet_gateway", ""},
+	}
+	for _, tt := range tests {
+		_, cidr, err := net.ParseCIDR(tt.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := g.routeTo(tt.subnet, cidr, tt.gatewayType)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: routeTo(%s, %s, %s) = %q, %v, want %q", tt.name, tt.subnet, tt.cidr, tt.gatewayType, got, ok, tt.want)
+		}
+	}
+}
+
+func TestSubnetAccess(t *testing.T) {
+	g := newGraph()
+	g.Topology.Place("aws_vpc.main", "aws_vpc", "")
+	*g.CytoscapeData = append(*g.CytoscapeData, cytoscapeNode{Data: cytoscapeNodeBody{ID: "aws_vpc.main", NodeType: "aws_vpc"}})
+	for _, subnet := range []string{"aws_subnet.pub", "aws_subnet.nat", "aws_subnet.main"} {
+		g.Topology.Place(subnet, "aws_subnet", "aws_vpc.main")
+		*g.CytoscapeData = append(*g.CytoscapeData, cytoscapeNode{Data: cytoscapeNodeBody{ID: subnet, NodeType: "aws_subnet", Parent: "aws_vpc.main"}})
+	}
+	g.Routing.Gateways["aws_internet_gateway.gw"] = "aws_internet_gateway"
+	g.Routing.Gateways["aws_nat_gateway.nat"] = "aws_nat_gateway"
+	g.Routing.RouteTableAssoc["aws_subnet.pub"] = "aws_route_table.pub"
+	g.Routing.RouteTableAssoc["aws_subnet.nat"] = "aws_route_table.nat"
+	g.Routing.MainRouteTables["aws_vpc.main"] = "aws_route_table.main"
+	g.Routing.Routes["aws_route_table.pub"] = []route{
+		{Destination: "0.0.0.0/0", Target: "aws_internet_gateway.gw", Kind: "gateway_id"},
+	}
+	g.Routing.Routes["aws_route_table.nat"] = []route{
+		{Destination: "0.0.0.0/0", Target: "aws_nat_gateway.nat", Kind: "nat_gateway_id"},
+		{Destination: "10.1.0.0/16", Target: "aws_internet_gateway.gw", Kind: "gateway_id"},
+	}
+	if err := evalRouting(&dag.Graph{}, g); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{"aws_subnet.pub": true, "aws_subnet.nat": false, "aws_subnet.main": false}
+	nodes, _ := analysisGraph(g)
+	for _, n := range *g.CytoscapeData {
+		if n.Data.NodeType == "aws_subnet" && n.Data.Public != want[n.Data.ID] {
+			t.Errorf("%s: public = %v, want %v", n.Data.ID, n.Data.Public, want[n.Data.ID])
+		}
+	}
+	subnets := 0
+	for _, n := range nodes {
+		if n.Type != "aws_subnet" {
+			continue
+		}
+		subnets++
+		access := "private"
+		if want[n.ID] {
+			access = "public"
+		}
+		if n.Access != access {
+			t.Errorf("%s: access = %q, want %q", n.ID, n.Access, access)
+		}
+	}
+	if subnets != len(want) {
+		t.Errorf("%d subnets exported, want %d", subnets, len(want))
+	}
+}
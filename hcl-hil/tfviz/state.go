@@ -0,0 +1,284 @@
+package tfviz
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/flatmap"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// the parts of a terraform 0.11 (version 3) state file used to build the graph
+type stateV3 struct {
+	Modules []struct {
+		Path      []string `json:"path"`
+		Resources map[string]struct {
+			Type      string   `json:"type"`
+			DependsOn []string `json:"depends_on"`
+			Primary   *struct {
+				ID         string            `json:"id"`
+				Attributes map[string]string `json:"attributes"`
+			} `json:"primary"`
+		} `json:"resources"`
+	} `json:"modules"`
+}
+
+// the parts of a terraform 0.12+ (version 4) state file used to build the graph
+type stateV4 struct {
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey       interface{}            `json:"index_key"`
+			Deposed        string                 `json:"deposed"`
+			Attributes     map[string]interface{} `json:"attributes"`
+			AttributesFlat map[string]string      `json:"attributes_flat"`
+			Dependencies   []string               `json:"dependencies"`
+			DependsOn      []string               `json:"depends_on"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// a resource instance recorded in a state file, before ids are resolved
+type stateInstance struct {
+	inst       *resourceInstance
+	attributes map[string]interface{}
+}
+
+// StateToCytoscape is the cytoscape JSON of what a state file records as deployed
+func StateToCytoscape(raw string) *CytoscapeResult {
+	thisGraph, err := stateToGraph(raw)
+	return formatResult(thisGraph, err, cytoscapeJSON)
+}
+
+// stateToGraph builds the network graph of what is actually deployed from the contents of a
+// terraform.tfstate file.  Attributes are taken as recorded, and ids of other resources in the
+// state (e.g. the vpc_id of a subnet) are resolved to the resources that own them.
+func stateToGraph(raw string) (*graph, error) {
+	instances, err := readState([]byte(raw))
+	if err != nil {
+		return nil, &stageError{Stage: stageLoad, Err: err}
+	}
+	return instancesToGraph(instances)
+}
+
+func readState(raw []byte) ([]*resourceInstance, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, fmt.Errorf("Error reading state: %s", err)
+	}
+
+	var recorded []*stateInstance
+	var err error
+	switch header.Version {
+	case 3:
+		recorded, err = readStateV3(raw)
+	case 4:
+		recorded, err = readStateV4(raw)
+	default:
+		return nil, fmt.Errorf("Error reading state: unsupported version %d", header.Version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading state: %s", err)
+	}
+
+	ids := map[string]string{}
+	for _, r := range recorded {
+		if id, ok := r.attributes["id"].(string); ok && id != "" {
+			ids[id] = r.inst.Info.HumanId()
+		}
+	}
+
+	instances := make([]*resourceInstance, len(recorded))
+	for i, r := range recorded {
+		cfg := resolveIDs(r.attributes, ids).(map[string]interface{})
+		delete(cfg, "id")
+		r.inst.Config = cfg
+		r.inst.DependsOn = append(r.inst.DependsOn, interpolatedResources(cfg)...)
+		instances[i] = r.inst
+	}
+	return instances, nil
+}
+
+func readStateV3(raw []byte) ([]*stateInstance, error) {
+	var state stateV3
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, err
+	}
+
+	var recorded []*stateInstance
+	for _, mod := range state.Modules {
+		path := mod.Path
+		if len(path) == 0 {
+			path = []string{"root"}
+		}
+		for key, res := range mod.Resources {
+			if res.Primary == nil || strings.HasPrefix(key, "data.") {
+				continue
+			}
+			// aws_instance.web, or aws_instance.web.0 when count is set
+			parts := strings.SplitN(key, ".", 3)
+			if len(parts) < 2 {
+				continue
+			}
+			resource := parts[0] + "." + parts[1]
+			id := resource
+			if len(parts) == 3 {
+				if n, err := strconv.Atoi(parts[2]); err == nil {
+					id = instanceAddress(resource, n)
+				}
+			}
+
+			attributes := map[string]interface{}{}
+			for k := range res.Primary.Attributes {
+				name := strings.SplitN(k, ".", 2)[0]
+				if _, ok := attributes[name]; !ok {
+					attributes[name] = flatmap.Expand(res.Primary.Attributes, name)
+				}
+			}
+			attributes["id"] = res.Primary.ID
+
+			var deps []string
+			for _, d := range res.DependsOn {
+				deps = append(deps, modulePath(path, strings.TrimSuffix(d, ".*")))
+			}
+
+			recorded = append(recorded, &stateInstance{
+				inst: &resourceInstance{
+					Info: &terraform.InstanceInfo{
+						Id:         id,
+						ModulePath: path,
+						Type:       res.Type,
+					},
+					Resource:  modulePath(path, resource),
+					DependsOn: deps,
+				},
+				attributes: attributes,
+			})
+		}
+	}
+	return recorded, nil
+}
+
+func readStateV4(raw []byte) ([]*stateInstance, error) {
+	var state stateV4
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, err
+	}
+
+	var recorded []*stateInstance
+	for _, res := range state.Resources {
+		if res.Mode != "managed" {
+			continue
+		}
+		path := modulePathOf(res.Module)
+		resource := res.Type + "." + res.Name
+
+		for _, inst := range res.Instances {
+			if inst.Deposed != "" {
+				continue
+			}
+			id := resource
+			switch key := inst.IndexKey.(type) {
+			case float64:
+				id = instanceAddress(resource, int(key))
+			case string:
+				id = instanceAddress(resource, key)
+			}
+
+			attributes := inst.Attributes
+			if attributes == nil {
+				// written by an older provider that never upgraded its schema
+				attributes = map[string]interface{}{}
+				for k := range inst.AttributesFlat {
+					name := strings.SplitN(k, ".", 2)[0]
+					if _, ok := attributes[name]; !ok {
+						attributes[name] = flatmap.Expand(inst.AttributesFlat, name)
+					}
+				}
+			}
+
+			var deps []string
+			for _, d := range inst.Dependencies {
+				deps = append(deps, absoluteAddress(d))
+			}
+			for _, d := range inst.DependsOn {
+				deps = append(deps, modulePath(path, d))
+			}
+
+			recorded = append(recorded, &stateInstance{
+				inst: &resourceInstance{
+					Info: &terraform.InstanceInfo{
+						Id:         id,
+						ModulePath: path,
+						Type:       res.Type,
+					},
+					Resource:  modulePath(path, resource),
+					DependsOn: deps,
+				},
+				attributes: attributes,
+			})
+		}
+	}
+	return recorded, nil
+}
+
+// the module calls at the start of an absolute address, e.g. module.b["x.y"].
+var moduleStep = regexp.MustCompile(`^module\.[^.\[]+(\[[^\]]*\])?\.`)
+
+// convert an absolute resource address, as in the dependencies of a v4 instance, into the
+// module.a.b.aws_vpc.main form modulePath gives, e.g. "module.a.module.b.aws_vpc.main"
+func absoluteAddress(addr string) string {
+	var module []string
+	for {
+		step := moduleStep.FindString(addr)
+		if step == "" {
+			break
+		}
+		module = append(module, strings.TrimSuffix(step, "."))
+		addr = addr[len(step):]
+	}
+	return modulePath(modulePathOf(strings.Join(module, ".")), addr)
+}
+
+// convert a module address into a module path, e.g. "module.a.module.b" -> {"root", "a", "b"}
+func modulePathOf(address string) []string {
+	path := []string{"root"}
+	if address == "" {
+		return path
+	}
+	for _, step := range strings.Split(address, ".module.") {
+		path = append(path, dottedAddress(strings.TrimPrefix(step, "module.")))
+	}
+	return path
+}
+
+// replace the ids of known resources in v with references to them
+func resolveIDs(v interface{}, ids map[string]string) interface{} {
+	switch t := v.(type) {
+	case string:
+		if addr, ok := ids[t]; ok {
+			return "${" + addr + ".id}"
+		}
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = resolveIDs(e, ids)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, e := range t {
+			list[i] = resolveIDs(e, ids)
+		}
+		return list
+	}
+	return v
+}
@@ -0,0 +1,230 @@
+package tfviz
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// the directory of the icons of web/style.json, set by tfviz.  Nodes whose icon can't be read are
+// drawn as plain boxes.
+var svgIconDir string
+
+// icons by node type, as in web/style.json
+var svgIcons = map[string]string{
+	"aws_instance":                    "aws/Compute/Compute_AmazonEC2.svg",
+	"google_compute_instance":         "cube.svg",
+	"azurerm_linux_virtual_machine":   "cube.svg",
+	"azurerm_windows_virtual_machine": "cube.svg",
+	"aws_network_interface":           "aws/Compute/Compute_AmazonVPC_elasticnetworkinterface.svg",
+	"autoscaling":                     "aws/Compute/Compute_AmazonEC2_AutoScaling.svg",
+	"aws_elb":                         "aws/Compute/Compute_ElasticLoadBalancing.svg",
+	"aws_lb":                          "aws/Compute/Compute_ElasticLoadBalancing_ApplicationLoadBalancer.svg",
+	"aws_alb":                         "aws/Compute/Compute_ElasticLoadBalancing_ApplicationLoadBalancer.svg",
+	"aws_internet_gateway":            "aws/Compute/Compute_AmazonVPC_Internetgateway.svg",
+	"aws_nat_gateway":                 "aws/Compute/Compute_AmazonVPC_VPCNATgateway.svg",
+	"aws_route_table":                 "aws/Compute/Compute_AmazonVPC_router.svg",
+	"aws_vpc_peering_connection":      "aws/Compute/Compute_AmazonVPC_VPCpeering.svg",
+	"aws_ec2_transit_gateway":         "aws/Compute/Compute_AmazonVPC_VPNgateway.svg",
+	"rds":                             "aws/Database/Database_AmazonRDS.svg",
+	"rds_rr":                          "aws/Database/Database_AmazonRDS_instancereadreplica.svg",
+	"cloud":                           "aws/General/General_Internet.svg",
+}
+
+// leaves drawn smaller than the others, as in web/style.json
+var svgIconSizes = map[string]int{
+	"aws_network_interface": 40,
+	"aws_lb_listener":       30,
+	"aws_alb_listener":      30,
+}
+
+// the box of a compound node, as in web/style.json
+type svgFrame struct {
+	Stroke string
+	Dash   string
+	Fill   string
+}
+
+var svgFrames = map[string]svgFrame{
+	"region":                    {"#000000", "", "#c0c0f0"},
+	"aws_vpc":                   {"#6b788c", "2,3", "#f09900"},
+	"google_compute_network":    {"#6b788c", "2,3", "#f09900"},
+	"azurerm_virtual_network":   {"#6b788c", "2,3", "#f09900"},
+	"az":                        {"#f4ad42", "6,4", "none"},
+	"aws_subnet":                {"#ff5959", "6,4", "none"},
+	"google_compute_subnetwork": {"#ff5959", "6,4", "none"},
+	"azurerm_subnet":            {"#ff5959", "6,4", "none"},
+}
+
+// how the edges are drawn: traffic, traffic whose replies network acls block, and edges that
+// carry no traffic like routes
+var svgEdgeStyles = map[string]struct{ Stroke, Dash string }{
+	"traffic": {"#888888", ""},
+	"blocked": {"#cc0000", "5,3"},
+	"route":   {"#999999", "2,3"},
+}
+
+func svgEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// the diagram as an SVG image, laid out by layoutDiagram, with the edges routed around the leaves
+func svgImage(thisGraph *graph) (string, error) {
+	d := newDiagram(thisGraph)
+	boxes := layoutDiagram(d)
+
+	// absolute boxes, in the order they are drawn: compound nodes before what they hold
+	var order []string
+	var place func(parent string, x int, y int)
+	place = func(parent string, x int, y int) {
+		for _, id := range d.Children[parent] {
+			b := boxes[id]
+			b.X, b.Y = b.X+x, b.Y+y
+			boxes[id] = b
+			order = append(order, id)
+			place(id, b.X, b.Y)
+		}
+	}
+	place("", 0, 0)
+	var leaves []box
+	for _, id := range order {
+		if !d.isCompound(id) {
+			leaves = append(leaves, boxes[id])
+		}
+	}
+	router := newEdgeRouter(leaves)
+	width, height := 0, 0
+	for _, id := range d.Children[""] {
+		if b := boxes[id]; b.X+b.W > width {
+			width = b.X + b.W
+		}
+		if b := boxes[id]; b.Y+b.H > height {
+			height = b.Y + b.H
+		}
+	}
+	width += 2 * layoutPadding  // room for loops on the right
+	height += 2 * layoutPadding // room for the labels of the bottom row
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n", width, height, width, height)
+	b.WriteString("  <defs>\n")
+	for _, name := range []string{"blocked", "route", "traffic"} {
+		fmt.Fprintf(&b, `    <marker id="arrow-%s" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="%s"/></marker>`+"\n", name, svgEdgeStyles[name].Stroke)
+	}
+	b.WriteString("  </defs>\n")
+	fmt.Fprintf(&b, `  <rect width="%d" height="%d" fill="#ffffff"/>`+"\n", width, height)
+
+	for _, id := range order {
+		if !d.isCompound(id) {
+			continue
+		}
+		frame, ok := svgFrames[d.byID[id].NodeType]
+		if !ok {
+			frame = svgFrame{"#666666", "", "none"}
+		}
+		n := boxes[id]
+		fmt.Fprintf(&b, `  <rect x="%d" y="%d" width="%d" height="%d" fill="%s" fill-opacity="0.1" stroke="%s" stroke-width="2"`, n.X, n.Y, n.W, n.H, frame.Fill, frame.Stroke)
+		if frame.Dash != "" {
+			fmt.Fprintf(&b, ` stroke-dasharray="%s"`, frame.Dash)
+		}
+		b.WriteString("/>\n")
+		fmt.Fprintf(&b, `  <text x="%d" y="%d" font-weight="bold">%s</text>`+"\n", n.X+10, n.Y+20, svgEscape(d.label(id)))
+	}
+
+	edges := append([]cytoscapeNodeBody{}, d.Edges...)
+	sort.SliceStable(edges, func(i, j int) bool {
+		if edges[i].Source != edges[j].Source {
+			return edges[i].Source < edges[j].Source
+		}
+		return edges[i].Target < edges[j].Target
+	})
+	for _, e := range edges {
+		s, ok := boxes[e.Source]
+		t, ok2 := boxes[e.Target]
+		if !ok || !ok2 {
+			continue
+		}
+		style := "traffic"
+		switch {
+		case e.RepliesBlocked:
+			style = "blocked"
+		case len(e.Ports) == 0:
+			style = "route"
+		}
+		stroke := fmt.Sprintf(`fill="none" stroke="%s" stroke-width="1.5" marker-end="url(#arrow-%s)"`, svgEdgeStyles[style].Stroke, style)
+		if dash := svgEdgeStyles[style].Dash; dash != "" {
+			stroke += fmt.Sprintf(` stroke-dasharray="%s"`, dash)
+		}
+		var labelAt point
+		if e.Source == e.Target {
+			// a loop over the top right corner
+			x, y := s.X+s.W, s.Y
+			fmt.Fprintf(&b, `  <path d="M%d,%d C%d,%d %d,%d %d,%d" %s/>`+"\n", x-15, y, x-15, y-30, x+30, y+15, x, y+15, stroke)
+			labelAt = point{x + 10, y - 12}
+		} else {
+			offset := 4
+			if e.Source > e.Target {
+				offset = -4
+			}
+			route := router.route(s, t, offset)
+			b.WriteString(`  <path d="`)
+			for i, p := range route {
+				if i == 0 {
+					fmt.Fprintf(&b, "M%d,%d", p.X, p.Y)
+				} else {
+					fmt.Fprintf(&b, " L%d,%d", p.X, p.Y)
+				}
+			}
+			fmt.Fprintf(&b, `" %s/>`+"\n", stroke)
+			labelAt = point{(route[1].X + route[2].X) / 2, (route[1].Y + route[2].Y) / 2}
+		}
+		if e.Label != "" {
+			fmt.Fprintf(&b, `  <text x="%d" y="%d" font-size="10" text-anchor="middle" fill="#333333" stroke="#ffffff" stroke-width="3" paint-order="stroke">%s</text>`+"\n", labelAt.X, labelAt.Y, svgEscape(e.Label))
+		}
+	}
+
+	icons := map[string]string{} // icon file -> data uri, empty when it can't be read
+	for _, id := range order {
+		if d.isCompound(id) {
+			continue
+		}
+		nodeType := d.byID[id].NodeType
+		n := boxes[id]
+		size := layoutIcon
+		if s, ok := svgIconSizes[nodeType]; ok {
+			size = s
+		}
+		x, y := n.X+(n.W-size)/2, n.Y+(n.H-size)/2
+		icon := ""
+		if file, ok := svgIcons[nodeType]; ok {
+			uri, ok := icons[file]
+			if !ok {
+				raw, err := ioutil.ReadFile(filepath.Join(svgIconDir, filepath.FromSlash(file)))
+				if err != nil {
+					thisGraph.warn("%s drawn without an icon: %s", nodeType, err)
+				} else {
+					uri = "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(raw)
+				}
+				icons[file] = uri
+			}
+			icon = uri
+		}
+		switch {
+		case icon != "":
+			fmt.Fprintf(&b, `  <image x="%d" y="%d" width="%d" height="%d" xlink:href="%s"/>`+"\n", x, y, size, size, icon)
+		case nodeType == "aws_lb_listener" || nodeType == "aws_alb_listener":
+			fmt.Fprintf(&b, `  <rect x="%d" y="%d" width="%d" height="%d" rx="6" fill="#8c4fff"/>`+"\n", x, y, size, size)
+		default:
+			fmt.Fprintf(&b, `  <rect x="%d" y="%d" width="%d" height="%d" rx="8" fill="#eeeeee" stroke="#666666"/>`+"\n", x, y, size, size)
+		}
+		fmt.Fprintf(&b, `  <text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", n.X+n.W/2, n.Y+n.H+15, svgEscape(d.label(id)))
+	}
+	b.WriteString("</svg>\n")
+	return b.String(), nil
+}
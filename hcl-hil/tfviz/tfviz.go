@@ -0,0 +1,186 @@
+// +build !js
+
+package tfviz
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// exit codes returned by the tfviz command
+const (
+	exitOK         = 0 // diagram written
+	exitGraphError = 1 // configuration loaded but the graph could not be built
+	exitUsage      = 2 // bad command line
+	exitLoadError  = 3 // configuration or its modules could not be loaded
+	exitWriteError = 4 // output could not be written
+)
+
+const tfvizUsage = `usage: tfviz [flags] [dir]
+
+Renders the Terraform configuration in dir (default ".") into the
+Cytoscape JSON consumed by the Terraform Visualizer webview, or with
+-format into:
+
+  topology  the JSON of the network the diagram is drawn from
+  dot       a Graphviz digraph
+  mermaid   a Mermaid flowchart
+  drawio    a file draw.io opens
+  graphml   GraphML, for graph analysis tools
+  gexf      GEXF, for graph analysis tools
+  svg       an SVG image, with the icons in the -icons directory
+  png       a PNG image, converted from the SVG one by rsvg-convert
+
+With -plan, renders the JSON plan printed by
+"terraform show -json <planfile>" instead, and with -state, what a
+terraform.tfstate file records as deployed. Use - to read either
+from stdin.
+
+Flags:
+`
+
+// Main runs the tfviz command line with args, the arguments after the name of the command, and
+// returns its exit code.  It is the native front end to the same pipeline DirToCytoscape uses,
+// for a main package that links in-house resource handlers with blank imports:
+//
+//	func main() {
+//		os.Exit(tfviz.Main(os.Args[1:]))
+//	}
+func Main(args []string) int {
+	flags := flag.NewFlagSet("tfviz", flag.ContinueOnError)
+	out := flags.String("o", "", "write the diagram to `file` instead of stdout")
+	plan := flags.String("plan", "", "render the JSON plan in `file` instead of a directory")
+	state := flags.String("state", "", "render the state in `file` instead of a directory")
+	formatName := flags.String("format", "cytoscape", "output `format`: "+strings.Join(formatNames(), ", "))
+	flags.StringVar(&svgIconDir, "icons", "", "`dir`ectory of the icons of the svg and png formats, web/icons of the extension\n(default ../web/icons from the directory of tfviz)")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, tfvizUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	format, ok := formats[*formatName]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "tfviz: unknown format %s\n", *formatName)
+		return exitUsage
+	}
+	if *formatName == "png" {
+		if err := checkPngConverter(); err != nil {
+			return reportDiagnostics(newDiagnostics(stageLoad, err))
+		}
+	}
+	if *formatName == "svg" || *formatName == "png" {
+		if svgIconDir == "" {
+			svgIconDir = defaultIconDir()
+		}
+		if fi, err := os.Stat(svgIconDir); err != nil || !fi.IsDir() {
+			fmt.Fprintf(os.Stderr, "tfviz: no icons in %s, give their directory with -icons\n", svgIconDir)
+			return exitUsage
+		}
+	}
+
+	var thisGraph *graph
+	var err error
+	if *plan != "" || *state != "" {
+		if flags.NArg() > 0 || *plan != "" && *state != "" {
+			flags.Usage()
+			return exitUsage
+		}
+		input, toGraph := *plan, planToGraph
+		if *state != "" {
+			input, toGraph = *state, stateToGraph
+		}
+		var raw []byte
+		raw, err = readInputFile(input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tfviz: %s\n", err)
+			return exitLoadError
+		}
+		thisGraph, err = toGraph(string(raw))
+	} else {
+		dir := "."
+		switch flags.NArg() {
+		case 0:
+		case 1:
+			dir = flags.Arg(0)
+		default:
+			flags.Usage()
+			return exitUsage
+		}
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			fmt.Fprintf(os.Stderr, "tfviz: %s is not a directory\n", dir)
+			return exitUsage
+		}
+		thisGraph, err = dirToGraph(dir)
+	}
+	result := formatResult(thisGraph, err, format)
+	if result.failed() {
+		return reportDiagnostics(result.Diagnostics)
+	}
+	for _, d := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "tfviz: warning: %s\n", d)
+	}
+
+	switch {
+	case *out == "" && binaryFormats[*formatName]:
+		_, err = os.Stdout.WriteString(result.Data)
+	case *out == "":
+		_, err = fmt.Fprintln(os.Stdout, result.Data)
+	default:
+		err = ioutil.WriteFile(*out, []byte(result.Data), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tfviz: error writing diagram: %s\n", err)
+		return exitWriteError
+	}
+	return exitOK
+}
+
+func formatNames() []string {
+	var names []string
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// web/icons of the extension, for tfviz built in this directory of it
+func defaultIconDir() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return filepath.Join("..", "web", "icons")
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Join(filepath.Dir(exe), "..", "web", "icons")
+}
+
+func readInputFile(name string) ([]byte, error) {
+	if name == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(name)
+}
+
+// print diags to stderr and pick the exit code for the earliest failing stage
+func reportDiagnostics(diags []*Diagnostic) int {
+	code := exitGraphError
+	for _, d := range diags {
+		fmt.Fprintf(os.Stderr, "tfviz: %s\n", d)
+		if d.Stage == stageLoad || d.Stage == stageModuleFetch {
+			code = exitLoadError
+		}
+	}
+	return code
+}
@@ -0,0 +1,28 @@
+package tfviz
+
+import (
+	"github.com/openixia/terraform-visualizer/hcl-hil/topology"
+)
+
+// DirTopology is the network the diagram of the configuration in dir is drawn from, for programs
+// that want the network rather than a diagram, with warnings about what it leaves out
+func DirTopology(dir string) (*topology.Topology, []*Diagnostic, error) {
+	return graphTopology(dirToGraph(dir))
+}
+
+// PlanTopology is DirTopology for the JSON plan printed by terraform show -json
+func PlanTopology(raw string) (*topology.Topology, []*Diagnostic, error) {
+	return graphTopology(planToGraph(raw))
+}
+
+// StateTopology is DirTopology for what a state file records as deployed
+func StateTopology(raw string) (*topology.Topology, []*Diagnostic, error) {
+	return graphTopology(stateToGraph(raw))
+}
+
+func graphTopology(thisGraph *graph, err error) (*topology.Topology, []*Diagnostic, error) {
+	if err != nil {
+		return nil, nil, err
+	}
+	return thisGraph.Topology, thisGraph.Warnings, nil
+}
@@ -0,0 +1,37 @@
+package tfviz
+
+import (
+	"testing"
+)
+
+func TestStateTopology(t *testing.T) {
+	state := `{"version": 4, "resources": [
+		{"mode": "managed", "type": "aws_vpc", "name": "x", "instances": [
+			{"attributes": {"id": "vpc-1", "cidr_block": "10.0.0.0/16"}}]},
+		{"mode": "managed", "type": "aws_subnet", "name": "a", "instances": [
+			{"attributes": {"id": "subnet-1", "vpc_id": "vpc-1", "cidr_block": "10.0.1.0/24"}}]},
+		{"mode": "managed", "type": "aws_security_group", "name": "sg", "instances": [
+			{"attributes": {"id": "sg-1", "vpc_id": "vpc-1", "ingress": [], "egress": []}}]},
+		{"mode": "managed", "type": "aws_instance", "name": "web", "each": "list", "instances": [
+			{"index_key": 0, "attributes": {"id": "i-1", "subnet_id": "subnet-1", "vpc_security_group_ids": ["sg-1"]}},
+			{"index_key": 1, "attributes": {"id": "i-2", "subnet_id": "subnet-1", "vpc_security_group_ids": ["sg-1"]}}]}
+	]}`
+	top, warnings, err := StateTopology(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none", warnings)
+	}
+	if cidr, _ := top.Cidr("aws_subnet.a"); cidr != "10.0.1.0/24" {
+		t.Errorf("cidr of aws_subnet.a = %q, want 10.0.1.0/24", cidr)
+	}
+	for _, id := range []string{"aws_instance.web[0]", "aws_instance.web[1]"} {
+		if parent := top.Parent(id); parent != "aws_subnet.a" {
+			t.Errorf("parent of %s = %q, want aws_subnet.a", id, parent)
+		}
+		if sgs := top.MemberGroups(id); len(sgs) != 1 || sgs[0] != "aws_security_group.sg" {
+			t.Errorf("security groups of %s = %v, want [aws_security_group.sg]", id, sgs)
+		}
+	}
+}
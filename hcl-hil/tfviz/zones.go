@@ -0,0 +1,212 @@
+package tfviz
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/config/module"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// the region of an availability zone, e.g. us-east-1a -> us-east-1
+var zoneRegion = regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-\d+`)
+
+// a provider region set from a variable, e.g. "${var.region}"
+var varRef = regexp.MustCompile(`^\$\{var\.([\w-]+)\}$`)
+
+// the region of an arn, e.g. arn:aws:ec2:us-east-1:123456789012:vpc/vpc-1 -> us-east-1
+func arnRegion(arn string) string {
+	parts := strings.SplitN(arn, ":", 5)
+	if len(parts) < 5 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[3]
+}
+
+// the provider configurations a module inherits when its module call has no providers
+// argument: the default, unaliased ones
+func defaultProviders(regions map[string]string) map[string]string {
+	inherited := map[string]string{}
+	for key, region := range regions {
+		if !strings.Contains(key, ".") {
+			inherited[key] = region
+		}
+	}
+	return inherited
+}
+
+// record the region of the provider configuration of every resource of a terraform 0.11
+// module tree.  inherited are the regions of the provider configurations passed down by the
+// module call.
+func legacyRegions(m *module.Tree, inherited map[string]string, thisGraph *graph) {
+	cfg := m.Config()
+	defaults := map[string]interface{}{}
+	for _, v := range cfg.Variables {
+		defaults[v.Name] = v.Default
+	}
+	regions := map[string]string{}
+	for key, region := range inherited {
+		regions[key] = region
+	}
+	for _, pc := range cfg.ProviderConfigs {
+		key := pc.Name
+		if pc.Alias != "" {
+			key += "." + pc.Alias
+		}
+		delete(regions, key)
+		if pc.RawConfig == nil {
+			continue
+		}
+		region, _ := pc.RawConfig.Raw["region"].(string)
+		if v := varRef.FindStringSubmatch(region); v != nil {
+			region, _ = defaults[v[1]].(string)
+		}
+		if region != "" && !isInterpolated(region) {
+			regions[key] = region
+		}
+	}
+
+	path := append([]string{"root"}, m.Path()...)
+	for _, r := range cfg.Resources {
+		provider := r.Provider
+		if provider == "" {
+			provider = strings.SplitN(r.Type, "_", 2)[0]
+		}
+		if region, ok := regions[provider]; ok {
+			thisGraph.Regions[modulePath(path, r.Id())] = region
+		}
+	}
+
+	children := m.Children()
+	for _, call := range cfg.Modules {
+		child, ok := children[call.Name]
+		if !ok {
+			continue
+		}
+		passed := defaultProviders(regions)
+		if len(call.Providers) > 0 {
+			passed = map[string]string{}
+			for key, parent := range call.Providers {
+				if region, ok := regions[parent]; ok {
+					passed[key] = region
+				}
+			}
+		}
+		legacyRegions(child, passed, thisGraph)
+	}
+}
+
+// record the region in the arn of a regional resource, e.g. a vpc read from a state, unless
+// the region of its provider is already known
+func (g *graph) addArnRegion(info *cytoInstanceInfo, c *terraform.ResourceConfig) {
+	resource := resourceAddress(info.ID)
+	if _, ok := g.Regions[resource]; ok {
+		return
+	}
+	if p, ok := c.Get("arn"); ok {
+		if region := arnRegion(p.(string)); region != "" {
+			g.Regions[resource] = region
+		}
+	}
+}
+
+// record the availability zone of a subnet, by name or else by id
+func (g *graph) addSubnetZone(info *cytoInstanceInfo, c *terraform.ResourceConfig) {
+	for _, key := range []string{"availability_zone", "availability_zone_id"} {
+		if p, ok := c.Get(key); ok {
+			if az, ok := p.(string); ok && az != "" && !isInterpolated(az) {
+				g.SubnetZones[info.ID] = az
+				return
+			}
+		}
+	}
+}
+
+func regionID(region string) string {
+	return "region/" + region
+}
+
+func zoneID(vpc string, az string) string {
+	return vpc + "/" + az
+}
+
+// once every resource is evaluated, nest the vpcs and transit gateways in a node for their
+// region, and the subnets of each vpc in a node for their availability zone.  A vpc without a
+// known provider region takes the region of the availability zones of its subnets.  Only the
+// drawn parents change: the topology still has the vpc of each subnet.
+func groupByZone(thisGraph *graph) error {
+	data := *thisGraph.CytoscapeData
+
+	zones := map[string][]string{} // vpc -> availability zones of its subnets
+	for _, e := range data {
+		if e.Data.NodeType != "aws_subnet" || e.Data.Parent == "" {
+			continue
+		}
+		if az, ok := thisGraph.SubnetZones[e.Data.ID]; ok && !containsString(zones[e.Data.Parent], az) {
+			zones[e.Data.Parent] = append(zones[e.Data.Parent], az)
+		}
+	}
+	for vpc := range zones {
+		sort.Strings(zones[vpc])
+	}
+
+	nodeRegions := map[string]string{}
+	var regions []string
+	for _, e := range data {
+		if e.Data.Parent != "" || e.Data.NodeType != "aws_vpc" && e.Data.NodeType != "aws_ec2_transit_gateway" {
+			continue
+		}
+		region := thisGraph.Regions[resourceAddress(e.Data.ID)]
+		for _, az := range zones[e.Data.ID] {
+			if region != "" {
+				break
+			}
+			region = zoneRegion.FindString(az)
+		}
+		if region == "" {
+			continue
+		}
+		nodeRegions[e.Data.ID] = region
+		if !containsString(regions, region) {
+			regions = append(regions, region)
+		}
+	}
+	sort.Strings(regions)
+
+	// parents go before their children
+	grouped := make([]cytoscapeNode, 0, len(data)+len(regions))
+	for _, region := range regions {
+		grouped = append(grouped, cytoscapeNode{
+			Data: cytoscapeNodeBody{ID: regionID(region), Name: region, NodeType: "region"},
+		})
+	}
+	for _, e := range data {
+		switch e.Data.NodeType {
+		case "aws_vpc", "aws_ec2_transit_gateway":
+			if region, ok := nodeRegions[e.Data.ID]; ok {
+				e.Data.Parent = regionID(region)
+			}
+		case "aws_subnet":
+			if az, ok := thisGraph.SubnetZones[e.Data.ID]; ok && e.Data.Parent != "" {
+				e.Data.Parent = zoneID(e.Data.Parent, az)
+			}
+		}
+		grouped = append(grouped, e)
+		if e.Data.NodeType == "aws_vpc" {
+			for _, az := range zones[e.Data.ID] {
+				grouped = append(grouped, cytoscapeNode{
+					Data: cytoscapeNodeBody{ID: zoneID(e.Data.ID, az), Name: az, NodeType: "az", Parent: e.Data.ID},
+				})
+			}
+		}
+	}
+
+	*thisGraph.CytoscapeData = grouped
+	for i, e := range grouped {
+		if e.Data.NodeType == "edge" {
+			thisGraph.Edges.Index[edgeKey(e.Data.Source, e.Data.Target)] = i
+		}
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+// Package topology is the network model the diagrams of tfviz are drawn from.  It is written
+// by tfviz -format topology and reads back with encoding/json, for programs that want the
+// network rather than a diagram, and is what resource handlers place their resources in.
+package topology
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+)
+
+// Topology is the network a diagram is drawn from: where every resource is placed, the
+// network interfaces, the members of each security group and the cidr blocks of the subnets.
+// It serializes to JSON as is.
+type Topology struct {
+	Nodes      map[string]*Node      `json:"nodes"`      // placed resources, by id
+	Interfaces map[string]*Interface `json:"interfaces"` // network interfaces, by id
+	Groups     map[string]*Group     `json:"groups"`     // security groups, by id
+	Subnets    map[string]*Subnet    `json:"subnets"`    // subnets, by id, whether placed or not
+
+	children map[string][]string // node -> ids of the nodes placed in it
+	groupsOf map[string][]string // group member -> its security groups
+}
+
+// Node is a resource placed in the network, e.g. a vpc, a subnet in its vpc or an
+// instance in its subnet.  Network interfaces are placed in their subnet without being drawn.
+type Node struct {
+	ID     string `json:"id"`
+	Type   string `json:"type,omitempty"`
+	Parent string `json:"parent,omitempty"`
+}
+
+// Subnet is the cidr block of a subnet, with what cidr block rules reach through it
+type Subnet struct {
+	ID      string   `json:"id"`
+	Cidr    string   `json:"cidr,omitempty"`
+	Members []string `json:"members,omitempty"` // instances, clones and attached interfaces
+}
+
+// Interface is a network interface, with the instance it is attached to
+type Interface struct {
+	ID       string   `json:"id"`
+	Subnet   string   `json:"subnet,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Instance string   `json:"instance,omitempty"`
+}
+
+// Group is a security group, with what security group rules reach through it
+type Group struct {
+	ID         string   `json:"id"`
+	Members    []string `json:"members,omitempty"` // instances, clones and attached interfaces
+	Interfaces []string `json:"interfaces,omitempty"`
+}
+
+// New is an empty topology
+func New() *Topology {
+	return &Topology{
+		Nodes:      map[string]*Node{},
+		Interfaces: map[string]*Interface{},
+		Groups:     map[string]*Group{},
+		Subnets:    map[string]*Subnet{},
+		children:   map[string][]string{},
+		groupsOf:   map[string][]string{},
+	}
+}
+
+// UnmarshalJSON reads a topology written by json.Marshal, rebuilding its indexes.  The JSON
+// doesn't record the order resources were placed in, so children come back sorted by id.
+func (t *Topology) UnmarshalJSON(data []byte) error {
+	type plain Topology
+	read := plain(*New())
+	if err := json.Unmarshal(data, &read); err != nil {
+		return err
+	}
+	*t = Topology(read)
+	t.children = map[string][]string{}
+	for _, id := range sortedKeys(t.Nodes) {
+		if n := t.Nodes[id]; n.Parent != "" {
+			t.children[n.Parent] = append(t.children[n.Parent], id)
+		}
+	}
+	t.groupsOf = map[string][]string{}
+	for _, sg := range t.GroupIDs() {
+		for _, m := range t.Groups[sg].Members {
+			t.groupsOf[m] = append(t.groupsOf[m], sg)
+		}
+	}
+	return nil
+}
+
+func sortedKeys(nodes map[string]*Node) []string {
+	var ids []string
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Place places a resource of the given type in parent, or at the top when parent is empty
+func (t *Topology) Place(id string, resourceType string, parent string) {
+	n, ok := t.Nodes[id]
+	if !ok {
+		n = &Node{ID: id}
+		t.Nodes[id] = n
+	}
+	if n.Parent != "" {
+		siblings := t.children[n.Parent]
+		for i, s := range siblings {
+			if s == id {
+				t.children[n.Parent] = append(siblings[:i:i], siblings[i+1:]...)
+				break
+			}
+		}
+	}
+	if resourceType != "" {
+		n.Type = resourceType
+	}
+	n.Parent = parent
+	if parent != "" {
+		t.children[parent] = append(t.children[parent], id)
+	}
+}
+
+func (t *Topology) subnet(id string) *Subnet {
+	s, ok := t.Subnets[id]
+	if !ok {
+		s = &Subnet{ID: id}
+		t.Subnets[id] = s
+	}
+	return s
+}
+
+// SetCidr records the cidr block of a subnet
+func (t *Topology) SetCidr(subnet string, cidr string) {
+	t.subnet(subnet).Cidr = cidr
+}
+
+// AddMember makes id reachable by the cidr block rules that cover the subnet
+func (t *Topology) AddMember(subnet string, id string) {
+	s := t.subnet(subnet)
+	s.Members = append(s.Members, id)
+}
+
+func (t *Topology) iface(id string) *Interface {
+	ni, ok := t.Interfaces[id]
+	if !ok {
+		ni = &Interface{ID: id}
+		t.Interfaces[id] = ni
+	}
+	return ni
+}
+
+// AddInterface places a network interface in its subnet
+func (t *Topology) AddInterface(id string, resourceType string, subnet string) {
+	t.Place(id, resourceType, subnet)
+	t.iface(id).Subnet = subnet
+}
+
+// AddInterfaceGroup puts a network interface in a security group
+func (t *Topology) AddInterfaceGroup(ni string, sg string) {
+	t.iface(ni).Groups = append(t.iface(ni).Groups, sg)
+	t.group(sg).Interfaces = append(t.group(sg).Interfaces, ni)
+}
+
+// Attach records the instance a network interface is attached to
+func (t *Topology) Attach(ni string, instance string) {
+	t.iface(ni).Instance = instance
+}
+
+func (t *Topology) group(id string) *Group {
+	g, ok := t.Groups[id]
+	if !ok {
+		g = &Group{ID: id}
+		t.Groups[id] = g
+	}
+	return g
+}
+
+// AddGroupMember makes id reachable by the rules of a security group
+func (t *Topology) AddGroupMember(sg string, id string) {
+	t.group(sg).Members = append(t.group(sg).Members, id)
+	t.groupsOf[id] = append(t.groupsOf[id], sg)
+}
+
+// Has is whether a resource was placed
+func (t *Topology) Has(id string) bool {
+	_, ok := t.Nodes[id]
+	return ok
+}
+
+// Parent is where a resource was placed, empty for a top level one like a vpc
+func (t *Topology) Parent(id string) string {
+	if n, ok := t.Nodes[id]; ok {
+		return n.Parent
+	}
+	return ""
+}
+
+// Children are the resources placed in a node, in the order they were placed, or sorted by id in
+// a topology read back from JSON
+func (t *Topology) Children(id string) []string {
+	return t.children[id]
+}
+
+// Cidr is the cidr block of a subnet
+func (t *Topology) Cidr(subnet string) (string, bool) {
+	if s, ok := t.Subnets[subnet]; ok && s.Cidr != "" {
+		return s.Cidr, true
+	}
+	return "", false
+}
+
+// SubnetIDs are the subnets with a cidr block or members, sorted
+func (t *Topology) SubnetIDs() []string {
+	var ids []string
+	for id := range t.Subnets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SubnetMembers is what the cidr block rules covering a subnet reach
+func (t *Topology) SubnetMembers(subnet string) []string {
+	if s, ok := t.Subnets[subnet]; ok {
+		return s.Members
+	}
+	return nil
+}
+
+// SubnetsWithin are the subnets entirely inside a cidr block, sorted.  A subnet only partly
+// inside doesn't count, since its instances may get an address outside the block.
+func (t *Topology) SubnetsWithin(cidr *net.IPNet) []string {
+	size, _ := cidr.Mask.Size()
+	var subnets []string
+	for _, id := range t.SubnetIDs() {
+		ip, sCidr, err := net.ParseCIDR(t.Subnets[id].Cidr)
+		if err != nil {
+			continue
+		}
+		if sSize, _ := sCidr.Mask.Size(); size <= sSize && cidr.Contains(ip) {
+			subnets = append(subnets, id)
+		}
+	}
+	return subnets
+}
+
+// GroupIDs are the security groups with members or interfaces, sorted
+func (t *Topology) GroupIDs() []string {
+	var ids []string
+	for id := range t.Groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GroupMembers is what the rules of a security group reach
+func (t *Topology) GroupMembers(sg string) []string {
+	if g, ok := t.Groups[sg]; ok {
+		return g.Members
+	}
+	return nil
+}
+
+// MemberGroups are the security groups whose rules reach a member, sorted
+func (t *Topology) MemberGroups(id string) []string {
+	sgs := append([]string{}, t.groupsOf[id]...)
+	sort.Strings(sgs)
+	return sgs
+}
+
+// InterfaceGroups are the security groups of a network interface
+func (t *Topology) InterfaceGroups(ni string) []string {
+	if i, ok := t.Interfaces[ni]; ok {
+		return i.Groups
+	}
+	return nil
+}
@@ -132,14 +132,23 @@ export default class TerraformVisualizerPanel extends PreviewDocumentContentProv
     private _getHtml() {
 
         const nonce = this.getNonce();
-        var data;
+        var result;
         try {
-            data = hcl.dirToCytoscape(this._workspaceRoot);
+            result = hcl.dirToCytoscape(this._workspaceRoot);
         } catch (e) {
             console.log(e);
             vscode.window.showErrorMessage(e + '');
             throw new Error(e);
         }
+        if (result.Diagnostics && result.Diagnostics.length > 0) {
+            const messages = result.Diagnostics.map(formatDiagnostic);
+            messages.forEach((m: string) => vscode.window.showErrorMessage(m));
+            throw new Error(messages.join('\n'));
+        }
+        if (result.Warnings) {
+            result.Warnings.map(formatDiagnostic).forEach((m: string) => vscode.window.showWarningMessage(m));
+        }
+        var data = result.Data;
 
         console.log("cytoscape_data:", data);
         outputFileSync(this._onDiskPath.fsPath + "/.tv/data.json", data);
@@ -286,4 +295,15 @@ export default class TerraformVisualizerPanel extends PreviewDocumentContentProv
         }
         return text;
     }
-}
\ No newline at end of file
+}
+
+/**
+ * Render a diagnostic or warning returned by dirToCytoscape as "file:line:col: [stage] message"
+ */
+function formatDiagnostic(d: any): string {
+    var location = '';
+    if (d.Pos) {
+        location = (d.Pos.Filename ? d.Pos.Filename + ':' : '') + d.Pos.Line + ':' + d.Pos.Column + ': ';
+    }
+    return `${location}[${d.Stage}] ${d.Err}`;
+}